@@ -0,0 +1,181 @@
+package prefix
+
+import (
+	"encoding"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// prefixedArg is an arg the hook has prefixed, it marks the command as rewritten so a command processed twice is never prefixed twice.
+// it holds the bytes go-redis would write for the arg, after the prefix, and go-redis writes it by MarshalBinary
+type prefixedArg []byte
+
+func (a prefixedArg) String() string {
+	return string(a)
+}
+
+func (a prefixedArg) MarshalBinary() ([]byte, error) {
+	return a, nil
+}
+
+// prefixArg add the prefix to the arg as go-redis writes it on the wire, e.g. a []byte key is not converted to a string
+func prefixArg(prefix string, arg interface{}) (interface{}, error) {
+	b, err := appendArg([]byte(prefix), arg)
+	if err != nil {
+		return nil, err
+	}
+	return prefixedArg(b), nil
+}
+
+// prefixArgs add the prefixes to the args at their positions, the args are left unchanged when one can not be prefixed
+func prefixArgs(args []interface{}, prefixes map[int]string) error {
+	prefixed := make(map[int]interface{}, len(prefixes))
+	for i, prefix := range prefixes {
+		arg, err := prefixArg(prefix, args[i])
+		if err != nil {
+			return err
+		}
+		prefixed[i] = arg
+	}
+	for i, arg := range prefixed {
+		args[i] = arg
+	}
+	return nil
+}
+
+// rewritten report whether the hook has already prefixed the args
+func rewritten(args []interface{}) bool {
+	for _, arg := range args {
+		if _, ok := arg.(prefixedArg); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// appendArg append the arg to b the way the go-redis writer encodes it
+func appendArg(b []byte, arg interface{}) ([]byte, error) {
+	switch v := arg.(type) {
+	case nil:
+		return b, nil
+	case string:
+		return append(b, v...), nil
+	case []byte:
+		return append(b, v...), nil
+	case prefixedArg:
+		return append(b, v...), nil
+	case int:
+		return strconv.AppendInt(b, int64(v), 10), nil
+	case int8:
+		return strconv.AppendInt(b, int64(v), 10), nil
+	case int16:
+		return strconv.AppendInt(b, int64(v), 10), nil
+	case int32:
+		return strconv.AppendInt(b, int64(v), 10), nil
+	case int64:
+		return strconv.AppendInt(b, v, 10), nil
+	case uint:
+		return strconv.AppendUint(b, uint64(v), 10), nil
+	case uint8:
+		return strconv.AppendUint(b, uint64(v), 10), nil
+	case uint16:
+		return strconv.AppendUint(b, uint64(v), 10), nil
+	case uint32:
+		return strconv.AppendUint(b, uint64(v), 10), nil
+	case uint64:
+		return strconv.AppendUint(b, v, 10), nil
+	case float32:
+		return strconv.AppendFloat(b, float64(v), 'f', -1, 64), nil
+	case float64:
+		return strconv.AppendFloat(b, v, 'f', -1, 64), nil
+	case bool:
+		if v {
+			return append(b, '1'), nil
+		}
+		return append(b, '0'), nil
+	case time.Time:
+		return v.AppendFormat(b, time.RFC3339Nano), nil
+	case time.Duration:
+		return strconv.AppendInt(b, v.Nanoseconds(), 10), nil
+	case encoding.BinaryMarshaler:
+		data, err := v.MarshalBinary()
+		if err != nil {
+			return nil, fmt.Errorf("redis prefix: marshal %T: %w", v, err)
+		}
+		return append(b, data...), nil
+	case net.IP:
+		return append(b, v...), nil
+	}
+	return appendPointerArg(b, arg)
+}
+
+// appendPointerArg append the value of a pointer arg, go-redis accepts the pointers to the basic types
+func appendPointerArg(b []byte, arg interface{}) ([]byte, error) {
+	var v interface{}
+	switch p := arg.(type) {
+	case *string:
+		if p != nil {
+			v = *p
+		}
+	case *int:
+		if p != nil {
+			v = *p
+		}
+	case *int8:
+		if p != nil {
+			v = *p
+		}
+	case *int16:
+		if p != nil {
+			v = *p
+		}
+	case *int32:
+		if p != nil {
+			v = *p
+		}
+	case *int64:
+		if p != nil {
+			v = *p
+		}
+	case *uint:
+		if p != nil {
+			v = *p
+		}
+	case *uint8:
+		if p != nil {
+			v = *p
+		}
+	case *uint16:
+		if p != nil {
+			v = *p
+		}
+	case *uint32:
+		if p != nil {
+			v = *p
+		}
+	case *uint64:
+		if p != nil {
+			v = *p
+		}
+	case *float32:
+		if p != nil {
+			v = *p
+		}
+	case *float64:
+		if p != nil {
+			v = *p
+		}
+	case *bool:
+		if p != nil {
+			v = *p
+		}
+	default:
+		return nil, fmt.Errorf("redis prefix: can't prefix %T (implement encoding.BinaryMarshaler)", arg)
+	}
+	if v == nil {
+		return nil, fmt.Errorf("redis prefix: can't prefix a nil %T", arg)
+	}
+	return appendArg(b, v)
+}
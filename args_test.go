@@ -0,0 +1,109 @@
+package prefix
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// userID is a key type which go-redis writes by MarshalBinary
+type userID int
+
+func (id userID) MarshalBinary() ([]byte, error) {
+	if id < 0 {
+		return nil, errors.New("negative user id")
+	}
+	return []byte("user:" + strconv.Itoa(int(id))), nil
+}
+
+func TestPrefixArg(t *testing.T) {
+	s := "key"
+	n := 42
+	var nilString *string
+	tests := []struct {
+		name     string
+		arg      interface{}
+		expected string
+		err      bool
+	}{
+		{"string", "key", "p:key", false},
+		{"bytes", []byte("key"), "p:key", false},
+		{"binary bytes", []byte{0, 0xff}, "p:\x00\xff", false},
+		{"nil", nil, "p:", false},
+		{"int", -7, "p:-7", false},
+		{"uint64", uint64(7), "p:7", false},
+		{"float", 1.5, "p:1.5", false},
+		{"bool", true, "p:1", false},
+		{"duration", time.Second, "p:1000000000", false},
+		{"time", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), "p:2024-01-02T03:04:05Z", false},
+		{"ip", net.IPv4(127, 0, 0, 1).To4(), "p:\x7f\x00\x00\x01", false},
+		{"string pointer", &s, "p:key", false},
+		{"int pointer", &n, "p:42", false},
+		{"binary marshaler", userID(1), "p:user:1", false},
+		{"binary marshaler error", userID(-1), "", true},
+		{"nil pointer", nilString, "", true},
+		{"struct", struct{ ID int }{1}, "", true},
+		{"map", map[string]string{}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			arg, err := prefixArg("p:", tt.arg)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, prefixedArg(tt.expected), arg)
+		})
+	}
+
+	t.Run("bytes are not shared", func(t *testing.T) {
+		key := []byte("key")
+		arg, _ := prefixArg("p:", key)
+		key[0] = 'K'
+		assert.Equal(t, prefixedArg("p:key"), arg)
+	})
+}
+
+func TestArgTypes(t *testing.T) {
+	prefix := "prefix4key:"
+	ctx := context.Background()
+	Cli, sent := newStubClient(AppPrefixHook{Prefix: prefix}, nil)
+
+	t.Run("bytes key", func(t *testing.T) {
+		*sent = nil
+		Cli.Set(ctx, string([]byte{0xff}), "value", 0)
+		Cli.Do(ctx, "get", []byte{0, 0xff})
+		assert.Equal(t, [][]string{
+			{"set", prefix + "\xff", "value"},
+			{"get", prefix + "\x00\xff"},
+		}, *sent)
+	})
+	t.Run("binary marshaler key", func(t *testing.T) {
+		*sent = nil
+		Cli.Do(ctx, "mget", userID(1), userID(2))
+		assert.Equal(t, [][]string{{"mget", prefix + "user:1", prefix + "user:2"}}, *sent)
+	})
+	t.Run("unconvertible key", func(t *testing.T) {
+		*sent = nil
+		err := Cli.Do(ctx, "mget", "key1", struct{ ID int }{1}).Err()
+		assert.EqualError(t, err, "redis prefix: can't prefix struct { ID int } (implement encoding.BinaryMarshaler)")
+		assert.Empty(t, *sent)
+	})
+	t.Run("binary marshaler error", func(t *testing.T) {
+		*sent = nil
+		err := Cli.Do(ctx, "get", userID(-1)).Err()
+		assert.EqualError(t, err, "redis prefix: marshal prefix.userID: negative user id")
+		assert.Empty(t, *sent)
+	})
+	t.Run("SCAN MATCH bytes pattern", func(t *testing.T) {
+		*sent = nil
+		Cli.Do(ctx, "scan", 0, "match", []byte("key*"))
+		assert.Equal(t, [][]string{{"scan", "0", "match", prefix + "key*"}}, *sent)
+	})
+}
@@ -0,0 +1,268 @@
+package prefix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/cast"
+)
+
+// KeySpecDiscovery load the key specs of all the commands from the server with COMMAND on first use, and cache them per server version.
+// set it on AppPrefixHook.Discovery, the hook then prefixes the commands it does not know by the specs of the server,
+// so new redis commands and module commands work too. the commands with a complex spec are resolved with COMMAND GETKEYS
+type KeySpecDiscovery struct {
+	// Client send the INFO, COMMAND and COMMAND GETKEYS of the discovery, e.g. the client the hook is added to.
+	// when it is nil they are sent by the hook chain, which is not possible inside a transaction: the discovery fails there
+	Client redis.UniversalClient
+
+	mu    sync.Mutex
+	table commandTable
+}
+
+// sendFunc send commands to redis behind the prefix hook, it is nil inside a transaction
+type sendFunc func(ctx context.Context, cmds ...redis.Cmder) error
+
+var errDiscoveryInTx = errors.New("redis prefix: discover key specs inside a transaction needs KeySpecDiscovery.Client")
+
+// sender return how the discovery sends its commands: by the Client when set, else by the send of the hook chain
+func (d *KeySpecDiscovery) sender(send sendFunc) sendFunc {
+	if d.Client == nil {
+		return send
+	}
+	return func(ctx context.Context, cmds ...redis.Cmder) error {
+		for _, cmd := range cmds {
+			// the ctx marks the commands as being rewritten, so a prefix hook on the Client lets them through
+			if err := d.Client.Process(ctx, cmd); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// commandTable the key specs by upper case command name, a subcommand is named like "XINFO|STREAM"
+type commandTable map[string]commandKeySpecs
+
+type commandKeySpecs struct {
+	specs []KeySpec
+	// the command is a container, e.g. XINFO, its keys are described by the subcommands
+	subcommands bool
+}
+
+// the tables already loaded, by redis_version
+var (
+	discoveredMu     sync.Mutex
+	discoveredTables = map[string]commandTable{}
+)
+
+// keySpecs return the key specs of the command, found is false when the server does not know the command
+func (d *KeySpecDiscovery) keySpecs(ctx context.Context, send sendFunc, args []interface{}) (specs []KeySpec, found bool, err error) {
+	send = d.sender(send)
+	table, err := d.load(ctx, send)
+	if err != nil {
+		return nil, false, err
+	}
+
+	name := strings.ToUpper(cast.ToString(args[0]))
+	command, found := table[name]
+	if !found {
+		return nil, false, nil
+	}
+	if command.subcommands && len(args) > 1 {
+		if sub, ok := table[name+"|"+strings.ToUpper(cast.ToString(args[1]))]; ok {
+			command = sub
+		}
+	}
+
+	for _, spec := range command.specs {
+		if _, err := spec.positions(args); spec.unknown || err != nil {
+			return d.getKeys(ctx, send, args)
+		}
+	}
+	return command.specs, true, nil
+}
+
+// load the command table of the server once
+func (d *KeySpecDiscovery) load(ctx context.Context, send sendFunc) (commandTable, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.table != nil {
+		return d.table, nil
+	}
+	if send == nil {
+		return nil, errDiscoveryInTx
+	}
+
+	info := redis.NewStringCmd(ctx, "info", "server")
+	if err := send(ctx, info); err != nil {
+		return nil, fmt.Errorf("redis prefix: discover key specs: %w", err)
+	}
+	version := serverVersion(info.Val())
+
+	discoveredMu.Lock()
+	table, ok := discoveredTables[version]
+	discoveredMu.Unlock()
+	if !ok {
+		command := redis.NewSliceCmd(ctx, "command")
+		if err := send(ctx, command); err != nil {
+			return nil, fmt.Errorf("redis prefix: discover key specs: %w", err)
+		}
+		table = parseCommandTable(command.Val())
+		if version != "" {
+			discoveredMu.Lock()
+			discoveredTables[version] = table
+			discoveredMu.Unlock()
+		}
+	}
+	d.table = table
+	return table, nil
+}
+
+// getKeys ask the server for the keys of the command, and find their positions in the args
+func (d *KeySpecDiscovery) getKeys(ctx context.Context, send sendFunc, args []interface{}) ([]KeySpec, bool, error) {
+	if send == nil {
+		return nil, false, errDiscoveryInTx
+	}
+	getKeys := redis.NewStringSliceCmd(ctx, append([]interface{}{"command", "getkeys"}, args...)...)
+	if err := send(ctx, getKeys); err != nil {
+		if strings.Contains(err.Error(), "no key arguments") {
+			return nil, true, nil
+		}
+		return nil, false, fmt.Errorf("redis prefix: command getkeys: %w", err)
+	}
+
+	var specs []KeySpec
+	i := 1
+	for _, key := range getKeys.Val() {
+		for ; i < len(args); i++ {
+			if cast.ToString(args[i]) == key {
+				specs = append(specs, KeyAt(i))
+				i++
+				break
+			}
+		}
+	}
+	return specs, true, nil
+}
+
+// serverVersion return the redis_version of an INFO server reply
+func serverVersion(info string) string {
+	for _, line := range strings.Split(info, "\n") {
+		if version, ok := strings.CutPrefix(strings.TrimSpace(line), "redis_version:"); ok {
+			return version
+		}
+	}
+	return ""
+}
+
+// parseCommandTable parse the COMMAND reply, every command is
+// [name, arity, flags, first key, last key, step, acl categories, tips, key specs, subcommands]
+func parseCommandTable(reply []interface{}) commandTable {
+	table := commandTable{}
+	var parse func(entries []interface{})
+	parse = func(entries []interface{}) {
+		for _, entry := range entries {
+			fields, ok := entry.([]interface{})
+			if !ok || len(fields) < 6 {
+				continue
+			}
+			name := strings.ToUpper(cast.ToString(fields[0]))
+			command := commandKeySpecs{}
+			if len(fields) > 8 {
+				for _, spec := range toSlice(fields[8]) {
+					command.specs = append(command.specs, parseKeySpec(toMap(spec)))
+				}
+			}
+			if len(fields) > 9 && len(toSlice(fields[9])) > 0 {
+				command.subcommands = true
+				parse(toSlice(fields[9]))
+			}
+			if len(command.specs) == 0 && !command.subcommands {
+				command.specs = legacyKeySpecs(toSlice(fields[2]), cast.ToInt(fields[3]), cast.ToInt(fields[4]), cast.ToInt(fields[5]))
+			}
+			table[name] = command
+		}
+	}
+	parse(reply)
+	return table
+}
+
+// parseKeySpec parse a key spec of redis 7:
+// {begin_search: {type: index|keyword, spec: {...}}, find_keys: {type: range|keynum, spec: {...}}}
+func parseKeySpec(m map[string]interface{}) KeySpec {
+	spec := KeySpec{}
+	for _, flag := range toSlice(m["flags"]) {
+		if strings.EqualFold(cast.ToString(flag), "INCOMPLETE") {
+			spec.unknown = true
+		}
+	}
+
+	beginSearch := toMap(m["begin_search"])
+	beginSpec := toMap(beginSearch["spec"])
+	switch cast.ToString(beginSearch["type"]) {
+	case "index":
+		spec.Index = cast.ToInt(beginSpec["index"])
+	case "keyword":
+		spec.Keyword = cast.ToString(beginSpec["keyword"])
+		spec.Index = cast.ToInt(beginSpec["startfrom"])
+	default:
+		spec.unknown = true
+	}
+
+	findKeys := toMap(m["find_keys"])
+	findSpec := toMap(findKeys["spec"])
+	switch cast.ToString(findKeys["type"]) {
+	case "range":
+		spec.LastKey = cast.ToInt(findSpec["lastkey"])
+		spec.Step = cast.ToInt(findSpec["keystep"])
+		spec.Limit = cast.ToInt(findSpec["limit"])
+	case "keynum":
+		spec.KeyNum = true
+		spec.KeyNumIndex = cast.ToInt(findSpec["keynumidx"])
+		spec.FirstKey = cast.ToInt(findSpec["firstkey"])
+		spec.Step = cast.ToInt(findSpec["keystep"])
+	default:
+		spec.unknown = true
+	}
+	return spec
+}
+
+// legacyKeySpecs build the key spec of a server before redis 7 from the first key, last key and step of the command
+func legacyKeySpecs(flags []interface{}, first, last, step int) []KeySpec {
+	if first <= 0 {
+		return nil
+	}
+	for _, flag := range flags {
+		if strings.EqualFold(cast.ToString(flag), "movablekeys") {
+			return []KeySpec{{unknown: true}}
+		}
+	}
+	return []KeySpec{KeyRange(first, last, step)}
+}
+
+// toMap convert a map of the RESP3 reply, or a flat key value array of the RESP2 reply
+func toMap(v interface{}) map[string]interface{} {
+	m := map[string]interface{}{}
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		for key, value := range v {
+			m[cast.ToString(key)] = value
+		}
+	case map[string]interface{}:
+		return v
+	case []interface{}:
+		for i := 0; i+1 < len(v); i += 2 {
+			m[cast.ToString(v[i])] = v[i+1]
+		}
+	}
+	return m
+}
+
+func toSlice(v interface{}) []interface{} {
+	s, _ := v.([]interface{})
+	return s
+}
@@ -0,0 +1,213 @@
+package prefix
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/cast"
+	"github.com/stretchr/testify/assert"
+)
+
+// resp3Spec build a key spec the way go-redis reads it from a RESP3 map
+func resp3Spec(beginType string, begin map[interface{}]interface{}, findType string, find map[interface{}]interface{}) interface{} {
+	return map[interface{}]interface{}{
+		"flags":        []interface{}{"RO"},
+		"begin_search": map[interface{}]interface{}{"type": beginType, "spec": begin},
+		"find_keys":    map[interface{}]interface{}{"type": findType, "spec": find},
+	}
+}
+
+// commandReply is a COMMAND reply with a few commands the hook does not know
+var commandReply = []interface{}{
+	[]interface{}{"lcsx", int64(-3), []interface{}{"readonly"}, int64(1), int64(2), int64(1), []interface{}{}, []interface{}{},
+		[]interface{}{resp3Spec("index", map[interface{}]interface{}{"index": int64(1)}, "range", map[interface{}]interface{}{"lastkey": int64(1), "keystep": int64(1), "limit": int64(0)})},
+		[]interface{}{},
+	},
+	[]interface{}{"xreadx", int64(-4), []interface{}{"readonly", "movablekeys"}, int64(0), int64(0), int64(0), []interface{}{}, []interface{}{},
+		// RESP2 flat key value arrays
+		[]interface{}{[]interface{}{
+			"flags", []interface{}{"RO"},
+			"begin_search", []interface{}{"type", "keyword", "spec", []interface{}{"keyword", "STREAMS", "startfrom", int64(1)}},
+			"find_keys", []interface{}{"type", "range", "spec", []interface{}{"lastkey", int64(-1), "keystep", int64(1), "limit", int64(2)}},
+		}},
+		[]interface{}{},
+	},
+	[]interface{}{"fcallx", int64(-3), []interface{}{"movablekeys"}, int64(0), int64(0), int64(0), []interface{}{}, []interface{}{},
+		[]interface{}{resp3Spec("index", map[interface{}]interface{}{"index": int64(2)}, "keynum", map[interface{}]interface{}{"keynumidx": int64(0), "firstkey": int64(1), "keystep": int64(1)})},
+		[]interface{}{},
+	},
+	[]interface{}{"module.get", int64(-2), []interface{}{"module", "movablekeys"}, int64(0), int64(0), int64(0), []interface{}{}, []interface{}{},
+		[]interface{}{resp3Spec("unknown", map[interface{}]interface{}{}, "unknown", map[interface{}]interface{}{})},
+		[]interface{}{},
+	},
+	[]interface{}{"xinfox", int64(-2), []interface{}{}, int64(0), int64(0), int64(0), []interface{}{}, []interface{}{}, []interface{}{},
+		[]interface{}{
+			[]interface{}{"xinfox|stream", int64(-3), []interface{}{"readonly"}, int64(2), int64(2), int64(1), []interface{}{}, []interface{}{},
+				[]interface{}{resp3Spec("index", map[interface{}]interface{}{"index": int64(2)}, "range", map[interface{}]interface{}{"lastkey": int64(0), "keystep": int64(1), "limit": int64(0)})},
+				[]interface{}{},
+			},
+			[]interface{}{"xinfox|help", int64(2), []interface{}{"loading"}, int64(0), int64(0), int64(0), []interface{}{}, []interface{}{}, []interface{}{}, []interface{}{}},
+		},
+	},
+	[]interface{}{"dbsizex", int64(1), []interface{}{"readonly"}, int64(0), int64(0), int64(0), []interface{}{}, []interface{}{}, []interface{}{}, []interface{}{}},
+	// a server before redis 7, without key specs
+	[]interface{}{"msetx", int64(-3), []interface{}{"write"}, int64(1), int64(-1), int64(2)},
+}
+
+func newDiscoveryClient(version string, unknownCommandPolicy UnknownCommandPolicy) (*redis.Client, *[][]string) {
+	return newStubClient(AppPrefixHook{Prefix: "prefix4key:", Discovery: &KeySpecDiscovery{}, UnknownCommandPolicy: unknownCommandPolicy}, func(cmd redis.Cmder) {
+		switch c := cmd.(type) {
+		case *redis.StringCmd:
+			if cmd.Name() == "info" {
+				c.SetVal("# Server\r\nredis_version:" + version + "\r\nredis_mode:standalone\r\n")
+			}
+		case *redis.SliceCmd:
+			if cmd.Name() == "command" {
+				c.SetVal(commandReply)
+			}
+		case *redis.StringSliceCmd:
+			if cmd.Name() == "command" && cast.ToString(cmd.Args()[1]) == "getkeys" {
+				c.SetVal([]string{"key2"})
+			}
+		}
+	})
+}
+
+func TestKeySpecDiscovery(t *testing.T) {
+	ctx := context.Background()
+	prefix := "prefix4key:"
+	Cli, sent := newDiscoveryClient("7.9.1", UnknownCommandReject)
+
+	tests := []struct {
+		name     string
+		args     []interface{}
+		expected []string
+	}{
+		{
+			name:     "range",
+			args:     []interface{}{"lcsx", "key1", "key2", "len"},
+			expected: []string{"lcsx", prefix + "key1", prefix + "key2", "len"},
+		},
+		{
+			name:     "keyword with limit",
+			args:     []interface{}{"xreadx", "count", 1, "streams", "key1", "key2", "0", "0"},
+			expected: []string{"xreadx", "count", "1", "streams", prefix + "key1", prefix + "key2", "0", "0"},
+		},
+		{
+			name:     "keynum",
+			args:     []interface{}{"fcallx", "fn", 2, "key1", "key2", "arg"},
+			expected: []string{"fcallx", "fn", "2", prefix + "key1", prefix + "key2", "arg"},
+		},
+		{
+			name:     "subcommand",
+			args:     []interface{}{"xinfox", "stream", "key1"},
+			expected: []string{"xinfox", "stream", prefix + "key1"},
+		},
+		{
+			name:     "keyless subcommand",
+			args:     []interface{}{"xinfox", "help"},
+			expected: []string{"xinfox", "help"},
+		},
+		{
+			name:     "keyless",
+			args:     []interface{}{"dbsizex"},
+			expected: []string{"dbsizex"},
+		},
+		{
+			name:     "legacy",
+			args:     []interface{}{"msetx", "key1", "value1", "key2", "value2"},
+			expected: []string{"msetx", prefix + "key1", "value1", prefix + "key2", "value2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*sent = nil
+			assert.NoError(t, Cli.Do(ctx, tt.args...).Err())
+			assert.Equal(t, tt.expected, (*sent)[len(*sent)-1])
+		})
+	}
+
+	t.Run("COMMAND GETKEYS", func(t *testing.T) {
+		*sent = nil
+		assert.NoError(t, Cli.Do(ctx, "module.get", "key1", "key2").Err())
+		assert.Equal(t, [][]string{
+			{"command", "getkeys", "module.get", "key1", "key2"},
+			{"module.get", "key1", prefix + "key2"},
+		}, *sent)
+	})
+	t.Run("unknown to the server", func(t *testing.T) {
+		var unknownErr *UnknownCommandError
+		assert.ErrorAs(t, Cli.Do(ctx, "nosuchcommand", "key").Err(), &unknownErr)
+	})
+}
+
+func TestKeySpecDiscoveryCache(t *testing.T) {
+	ctx := context.Background()
+	countCommand := func(sent [][]string) (n int) {
+		for _, args := range sent {
+			if len(args) == 1 && args[0] == "command" {
+				n++
+			}
+		}
+		return n
+	}
+
+	Cli1, sent1 := newDiscoveryClient("7.9.2", UnknownCommandReject)
+	Cli1.Do(ctx, "lcsx", "key1", "key2")
+	Cli1.Do(ctx, "fcallx", "fn", 1, "key1")
+	assert.Equal(t, 1, countCommand(*sent1))
+
+	// another hook on a server of the same version loads the cached table
+	Cli2, sent2 := newDiscoveryClient("7.9.2", UnknownCommandReject)
+	assert.NoError(t, Cli2.Do(ctx, "lcsx", "key1", "key2").Err())
+	assert.Equal(t, 0, countCommand(*sent2))
+	assert.Equal(t, []string{"info", "server"}, (*sent2)[0])
+}
+
+func TestKeySpecDiscoveryFailed(t *testing.T) {
+	ctx := context.Background()
+	Cli, sent := newStubClient(AppPrefixHook{Prefix: "prefix4key:", Discovery: &KeySpecDiscovery{}, UnknownCommandPolicy: UnknownCommandReject}, func(cmd redis.Cmder) {
+		if cmd.Name() == "info" {
+			cmd.SetErr(errors.New("NOPERM this user has no permissions to run the 'info' command"))
+		}
+	})
+	var unknownErr *UnknownCommandError
+	assert.ErrorAs(t, Cli.Do(ctx, "lcsx", "key1", "key2").Err(), &unknownErr)
+	assert.Equal(t, [][]string{{"info", "server"}}, *sent)
+}
+
+func TestKeySpecDiscoveryTxPipelined(t *testing.T) {
+	ctx := context.Background()
+	lcsx := func(pipe redis.Pipeliner) error {
+		pipe.Do(ctx, "lcsx", "key1", "key2")
+		return nil
+	}
+
+	t.Run("Client", func(t *testing.T) {
+		discovery, discoverySent := newDiscoveryClient("7.9.3", UnknownCommandReject)
+		Cli, sent := newStubClient(AppPrefixHook{
+			Prefix:               "prefix4key:",
+			Discovery:            &KeySpecDiscovery{Client: discovery},
+			UnknownCommandPolicy: UnknownCommandReject,
+		}, nil)
+		_, err := Cli.TxPipelined(ctx, lcsx)
+		assert.NoError(t, err)
+		// the discovery never goes into the transaction
+		assert.Equal(t, [][]string{{"multi"}, {"lcsx", "prefix4key:key1", "prefix4key:key2"}, {"exec"}}, *sent)
+		assert.Equal(t, [][]string{{"info", "server"}, {"command"}}, *discoverySent)
+	})
+	t.Run("without Client", func(t *testing.T) {
+		Cli, sent := newStubClient(AppPrefixHook{
+			Prefix:               "prefix4key:",
+			Discovery:            &KeySpecDiscovery{},
+			UnknownCommandPolicy: UnknownCommandReject,
+		}, nil)
+		_, err := Cli.TxPipelined(ctx, lcsx)
+		var unknownErr *UnknownCommandError
+		assert.ErrorAs(t, err, &unknownErr)
+		assert.Empty(t, *sent)
+	})
+}
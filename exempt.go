@@ -0,0 +1,94 @@
+package prefix
+
+// exemptKey report whether the key arg matches one of the ExemptKeys patterns
+func (h AppPrefixHook) exemptKey(arg interface{}) bool {
+	if len(h.ExemptKeys) == 0 {
+		return false
+	}
+	key, err := appendArg(nil, arg)
+	if err != nil {
+		return false
+	}
+	for _, pattern := range h.ExemptKeys {
+		if matchGlob(pattern, string(key)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob match s against the glob pattern the way redis matches KEYS patterns: * ? [abc] [^abc] [a-z], and \ escapes a character
+func matchGlob(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if matchGlob(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+			pattern, s = pattern[1:], s[1:]
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+			var match bool
+			if pattern, match = matchClass(pattern, s[0]); !match {
+				return false
+			}
+			s = s[1:]
+		default:
+			if pattern[0] == '\\' && len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+			pattern, s = pattern[1:], s[1:]
+		}
+	}
+	return len(s) == 0
+}
+
+// matchClass match c against the [...] class at the head of the pattern, and return the pattern after the class
+func matchClass(pattern string, c byte) (string, bool) {
+	pattern = pattern[1:]
+	negate := len(pattern) > 0 && pattern[0] == '^'
+	if negate {
+		pattern = pattern[1:]
+	}
+	match := false
+	for len(pattern) > 0 && pattern[0] != ']' {
+		switch {
+		case pattern[0] == '\\' && len(pattern) > 1:
+			match = match || pattern[1] == c
+			pattern = pattern[2:]
+		case len(pattern) > 2 && pattern[1] == '-' && pattern[2] != ']':
+			lo, hi := pattern[0], pattern[2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			match = match || c >= lo && c <= hi
+			pattern = pattern[3:]
+		default:
+			match = match || pattern[0] == c
+			pattern = pattern[1:]
+		}
+	}
+	if len(pattern) > 0 {
+		// the closing ]
+		pattern = pattern[1:]
+	}
+	return pattern, match != negate
+}
@@ -0,0 +1,106 @@
+package prefix
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		s       string
+		match   bool
+	}{
+		{"global:*", "global:flags", true},
+		{"global:*", "global:", true},
+		{"global:*", "tenant:global:flags", false},
+		{"ratelimit:cfg", "ratelimit:cfg", true},
+		{"ratelimit:cfg", "ratelimit:cfg2", false},
+		{"*:cfg", "a/b:cfg", true},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h*llo", "heeeello", true},
+		{"h**llo", "hllo", true},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{"h[b-a]llo", "hbllo", true},
+		{"h[a-b]llo", "hcllo", false},
+		{`h\*llo`, "h*llo", true},
+		{`h\*llo`, "hello", false},
+		{`h[\]]llo`, "h]llo", true},
+		{"", "", true},
+		{"", "a", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.s, func(t *testing.T) {
+			assert.Equal(t, tt.match, matchGlob(tt.pattern, tt.s))
+		})
+	}
+}
+
+func TestExemptKeys(t *testing.T) {
+	prefix := "prefix4key:"
+	ctx := context.Background()
+	Cli, sent := newStubClient(AppPrefixHook{Prefix: prefix, ExemptKeys: []string{"global:*", "ratelimit:cfg"}}, func(cmd redis.Cmder) {
+		if c, ok := cmd.(*redis.KeyValuesCmd); ok {
+			c.SetVal("global:queue", []string{"job"})
+		}
+	})
+
+	t.Run("mixed keys", func(t *testing.T) {
+		*sent = nil
+		Cli.MGet(ctx, "key1", "global:flags", "ratelimit:cfg", "ratelimit:cfg2")
+		Cli.Rename(ctx, "global:tmp", "key1")
+		Cli.SUnionStore(ctx, "dest", "key1", "global:set")
+		Cli.Eval(ctx, "return 1", []string{"global:lock", "key1"}, "global:arg")
+		assert.Equal(t, [][]string{
+			{"mget", prefix + "key1", "global:flags", "ratelimit:cfg", prefix + "ratelimit:cfg2"},
+			{"rename", "global:tmp", prefix + "key1"},
+			{"sunionstore", prefix + "dest", prefix + "key1", "global:set"},
+			{"eval", "return 1", "2", "global:lock", prefix + "key1", "global:arg"},
+		}, *sent)
+	})
+	t.Run("patterns", func(t *testing.T) {
+		*sent = nil
+		Cli.Keys(ctx, "global:*")
+		Cli.Keys(ctx, "global*")
+		Cli.Scan(ctx, 0, "global:*", 10)
+		Cli.Sort(ctx, "global:list", &redis.Sort{By: "global:*", Get: []string{"global:*"}})
+		assert.Equal(t, [][]string{
+			{"keys", prefix + "global:*"},
+			{"keys", prefix + "global*"},
+			{"scan", "0", "match", prefix + "global:*", "count", "10"},
+			{"sort", "global:list", "by", prefix + "global:*", "get", prefix + "global:*"},
+		}, *sent)
+	})
+	t.Run("pipeline", func(t *testing.T) {
+		*sent = nil
+		_, err := Cli.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Get(ctx, "key1")
+			pipe.HGetAll(ctx, "global:flags")
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, [][]string{{"get", prefix + "key1"}, {"hgetall", "global:flags"}}, *sent)
+	})
+	t.Run("reply", func(t *testing.T) {
+		key, values, err := Cli.LMPop(ctx, "left", 1, "key1", "global:queue").Result()
+		assert.NoError(t, err)
+		assert.Equal(t, "global:queue", key)
+		assert.Equal(t, []string{"job"}, values)
+	})
+	t.Run("cross slot", func(t *testing.T) {
+		Cli, sent := newStubClient(AppPrefixHook{Prefix: "{tenant42}:", ExemptKeys: []string{"global:*"}, CheckCrossSlot: true}, nil)
+		var crossSlot *CrossSlotError
+		assert.True(t, errors.As(Cli.MGet(ctx, "key1", "global:flags").Err(), &crossSlot))
+		assert.Equal(t, []string{"{tenant42}:key1", "global:flags"}, crossSlot.Keys)
+		assert.Empty(t, *sent)
+	})
+}
@@ -0,0 +1,116 @@
+package prefix
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/cast"
+)
+
+var (
+	// #!lua name=mylib
+	libraryNameRe = regexp.MustCompile(`^(#!\w+\b[^\n]*?\bname=)(\w+)`)
+	// redis.register_function('myfunc', ...) and redis.register_function{function_name='myfunc', ...}
+	registerFunctionRe = regexp.MustCompile(`(redis\.register_function\s*\(\s*|function_name\s*=\s*)(['"])(\w+)(['"])`)
+)
+
+// functionPrefix the prefix of the library and function names, they only allow letters, digits and underscores.
+// the encoding is injective, so two namespaces never share a library: an underscore is doubled, any other byte is an underscore
+// and its two hex digits, and the "_n_" terminator ends the prefix, e.g. "tenant:1:" -> "tenant_3a1_3a_n_", "a_b" -> "a__b_n_"
+func functionPrefix(prefix string) string {
+	var b strings.Builder
+	for i := 0; i < len(prefix); i++ {
+		switch c := prefix[i]; {
+		case c == '_':
+			b.WriteString("__")
+		case c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "_%02x", c)
+		}
+	}
+	// no byte is encoded as an underscore followed by n
+	b.WriteString("_n_")
+	return b.String()
+}
+
+// ErrSharedFunctions is the error of the FUNCTION subcommands which act on the libraries of all the namespaces, with NamespaceFunctions
+var ErrSharedFunctions = errors.New("redis prefix: the command acts on the functions of all the namespaces")
+
+// namespaceFunctions add the function prefix to the library and function names of the command,
+// done is true when the command has no keys left to prefix
+func namespaceFunctions(args []interface{}, prefix string) (done bool, err error) {
+	if len(args) < 2 {
+		return false, nil
+	}
+	fnPrefix := functionPrefix(prefix)
+	switch strings.ToUpper(cast.ToString(args[0])) {
+	case "FCALL", "FCALL_RO": // FCALL function numkeys [key ...] [arg ...], the keys are prefixed by the key specs
+		return false, prefixArgs(args, map[int]string{1: fnPrefix})
+	case "FUNCTION":
+	default:
+		return false, nil
+	}
+
+	switch sub := strings.ToUpper(cast.ToString(args[1])); sub {
+	case "FLUSH", "RESTORE", "DUMP": // FUNCTION FLUSH wipes, RESTORE overwrites and DUMP reads the libraries of every namespace
+		return true, fmt.Errorf("%w: FUNCTION %s", ErrSharedFunctions, sub)
+	case "LOAD": // FUNCTION LOAD [REPLACE] function-code
+		if len(args) < 3 {
+			return false, nil
+		}
+		i := len(args) - 1
+		args[i] = prefixedArg(namespaceFunctionCode(cast.ToString(args[i]), fnPrefix))
+		return true, nil
+	case "DELETE": // FUNCTION DELETE library-name
+		if len(args) < 3 {
+			return false, nil
+		}
+		return true, prefixArgs(args, map[int]string{2: fnPrefix})
+	case "LIST": // FUNCTION LIST [LIBRARYNAME library-name-pattern] [WITHCODE]
+		for i := 2; i+1 < len(args); i++ {
+			if strings.EqualFold(cast.ToString(args[i]), "LIBRARYNAME") {
+				return true, prefixArgs(args, map[int]string{i + 1: fnPrefix})
+			}
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// namespaceFunctionCode add the function prefix to the library name of the shebang and to the registered function names
+func namespaceFunctionCode(code, fnPrefix string) string {
+	code = libraryNameRe.ReplaceAllString(code, "${1}"+fnPrefix+"${2}")
+	return registerFunctionRe.ReplaceAllString(code, "${1}${2}"+fnPrefix+"${3}${4}")
+}
+
+// trimFunctionReply strip the function prefix from the library and function names of the reply,
+// FUNCTION LIST only returns the libraries of the namespace
+func trimFunctionReply(cmd redis.Cmder, prefix string) {
+	if cmd.Err() != nil || len(cmd.Args()) < 2 || !strings.EqualFold(cmd.Name(), "FUNCTION") {
+		return
+	}
+	fnPrefix := functionPrefix(prefix)
+	switch c := cmd.(type) {
+	case *redis.StringCmd: // FUNCTION LOAD -> library name
+		if strings.EqualFold(cast.ToString(cmd.Args()[1]), "LOAD") {
+			c.SetVal(trimKey(c.Val(), fnPrefix))
+		}
+	case *redis.FunctionListCmd:
+		libraries := make([]redis.Library, 0, len(c.Val()))
+		for _, library := range c.Val() {
+			if !strings.HasPrefix(library.Name, fnPrefix) {
+				continue
+			}
+			library.Name = trimKey(library.Name, fnPrefix)
+			for i := range library.Functions {
+				library.Functions[i].Name = trimKey(library.Functions[i].Name, fnPrefix)
+			}
+			libraries = append(libraries, library)
+		}
+		c.SetVal(libraries)
+	}
+}
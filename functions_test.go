@@ -0,0 +1,133 @@
+package prefix
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/cast"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFunctionPrefix(t *testing.T) {
+	assert.Equal(t, "prefix4key_3a_n_", functionPrefix("prefix4key:"))
+	assert.Equal(t, "t_7b1_7da_2db_3a_n_", functionPrefix("t{1}a-b:"))
+	assert.Equal(t, "_n_", functionPrefix(""))
+
+	// the namespaces which a lossy sanitization would merge, or whose function prefix would be the head of another one
+	prefixes := []string{"a:b:", "a_b_", "a-b-", "a:", "a_", "a", "a:b", "a_3a", "a__", "a_n_", "A:"}
+	seen := map[string]string{}
+	for _, prefix := range prefixes {
+		fnPrefix := functionPrefix(prefix)
+		assert.Regexp(t, `^\w+$`, fnPrefix)
+		for other, otherFnPrefix := range seen {
+			assert.False(t, strings.HasPrefix(fnPrefix, otherFnPrefix), "%q and %q share functions", prefix, other)
+			assert.False(t, strings.HasPrefix(otherFnPrefix, fnPrefix), "%q and %q share functions", prefix, other)
+		}
+		seen[prefix] = fnPrefix
+	}
+}
+
+func TestNamespaceFunctionCode(t *testing.T) {
+	code := "#!lua name=mylib\n" +
+		"redis.register_function('knockknock', function() return 'Who is there?' end)\n" +
+		"redis.register_function(\"myfunc\", function(keys, args) return args[1] end)\n" +
+		"redis.register_function{function_name='noflags', callback=function() return 1 end, flags={'no-writes'}}\n"
+	expected := "#!lua name=t_mylib\n" +
+		"redis.register_function('t_knockknock', function() return 'Who is there?' end)\n" +
+		"redis.register_function(\"t_myfunc\", function(keys, args) return args[1] end)\n" +
+		"redis.register_function{function_name='t_noflags', callback=function() return 1 end, flags={'no-writes'}}\n"
+	assert.Equal(t, expected, namespaceFunctionCode(code, "t_"))
+}
+
+func TestNamespaceFunctions(t *testing.T) {
+	prefix := "tenant:1:"
+	ctx := context.Background()
+	Cli, sent := newStubClient(AppPrefixHook{Prefix: prefix, NamespaceFunctions: true}, func(cmd redis.Cmder) {
+		switch c := cmd.(type) {
+		case *redis.StringCmd:
+			c.SetVal("tenant_3a1_3a_n_mylib")
+		case *redis.FunctionListCmd:
+			c.SetVal([]redis.Library{
+				{Name: "tenant_3a1_3a_n_mylib", Functions: []redis.Function{{Name: "tenant_3a1_3a_n_myfunc"}}},
+				{Name: "tenant_3a2_3a_n_mylib", Functions: []redis.Function{{Name: "tenant_3a2_3a_n_myfunc"}}},
+			})
+		}
+	})
+
+	tests := []struct {
+		name     string
+		cmd      func() redis.Cmder
+		expected []interface{}
+	}{
+		{
+			name: "FUNCTION LOAD command",
+			cmd: func() redis.Cmder {
+				return Cli.FunctionLoad(ctx, "#!lua name=mylib\nredis.register_function('myfunc', f)")
+			},
+			expected: []interface{}{"function", "load", "#!lua name=tenant_3a1_3a_n_mylib\nredis.register_function('tenant_3a1_3a_n_myfunc', f)"},
+		},
+		{
+			name:     "FUNCTION LOAD REPLACE command",
+			cmd:      func() redis.Cmder { return Cli.FunctionLoadReplace(ctx, "#!lua name=mylib\n") },
+			expected: []interface{}{"function", "load", "replace", "#!lua name=tenant_3a1_3a_n_mylib\n"},
+		},
+		{
+			name:     "FUNCTION DELETE command",
+			cmd:      func() redis.Cmder { return Cli.FunctionDelete(ctx, "mylib") },
+			expected: []interface{}{"function", "delete", "tenant_3a1_3a_n_mylib"},
+		},
+		{
+			name:     "FUNCTION LIST command",
+			cmd:      func() redis.Cmder { return Cli.FunctionList(ctx, redis.FunctionListQuery{LibraryNamePattern: "my*"}) },
+			expected: []interface{}{"function", "list", "libraryname", "tenant_3a1_3a_n_my*"},
+		},
+		{
+			name:     "FCALL command",
+			cmd:      func() redis.Cmder { return Cli.FCall(ctx, "myfunc", []string{"key1", "key2"}, "arg") },
+			expected: []interface{}{"fcall", "tenant_3a1_3a_n_myfunc", 2, prefix + "key1", prefix + "key2", "arg"},
+		},
+		{
+			name:     "FCALL_RO command",
+			cmd:      func() redis.Cmder { return Cli.FCallRO(ctx, "myfunc", nil) },
+			expected: []interface{}{"fcall_ro", "tenant_3a1_3a_n_myfunc", 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*sent = nil
+			tt.cmd()
+			assert.Equal(t, [][]string{cast.ToStringSlice(tt.expected)}, *sent)
+		})
+	}
+
+	t.Run("FUNCTION LOAD reply", func(t *testing.T) {
+		assert.Equal(t, "mylib", Cli.FunctionLoad(ctx, "#!lua name=mylib\n").Val())
+	})
+	t.Run("FUNCTION LIST reply", func(t *testing.T) {
+		libraries := Cli.FunctionList(ctx, redis.FunctionListQuery{}).Val()
+		assert.Equal(t, []redis.Library{{Name: "mylib", Functions: []redis.Function{{Name: "myfunc"}}}}, libraries)
+	})
+	t.Run("FUNCTION LIST of a namespace which is the head of another one", func(t *testing.T) {
+		Cli, _ := newStubClient(AppPrefixHook{Prefix: "tenant:", NamespaceFunctions: true}, func(cmd redis.Cmder) {
+			if c, ok := cmd.(*redis.FunctionListCmd); ok {
+				c.SetVal([]redis.Library{{Name: functionPrefix("tenant:") + "mylib"}, {Name: functionPrefix("tenant:1:") + "mylib"}})
+			}
+		})
+		assert.Equal(t, []redis.Library{{Name: "mylib"}}, Cli.FunctionList(ctx, redis.FunctionListQuery{}).Val())
+	})
+	t.Run("commands on all the namespaces", func(t *testing.T) {
+		*sent = nil
+		assert.ErrorIs(t, Cli.FunctionFlush(ctx).Err(), ErrSharedFunctions)
+		assert.ErrorIs(t, Cli.FunctionFlushAsync(ctx).Err(), ErrSharedFunctions)
+		assert.ErrorIs(t, Cli.FunctionRestore(ctx, "dump").Err(), ErrSharedFunctions)
+		assert.ErrorIs(t, Cli.FunctionDump(ctx).Err(), ErrSharedFunctions)
+		assert.Empty(t, *sent)
+	})
+	t.Run("off by default", func(t *testing.T) {
+		Cli, sent := newStubClient(AppPrefixHook{Prefix: prefix}, nil)
+		Cli.FCall(ctx, "myfunc", []string{"key1"})
+		assert.Equal(t, [][]string{{"fcall", "myfunc", "1", prefix + "key1"}}, *sent)
+	})
+}
@@ -4,7 +4,6 @@ go 1.23.4
 
 require (
 	github.com/redis/go-redis/v9 v9.7.1
-	github.com/samber/lo v1.49.1
 	github.com/spf13/cast v1.7.1
 	github.com/stretchr/testify v1.10.0
 )
@@ -13,7 +12,8 @@ require (
 	github.com/cespare/xxhash/v2 v2.3.0 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/niemeyer/pretty v0.0.0-20200227124842-a10e7caefd8e // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	golang.org/x/text v0.22.0 // indirect
+	gopkg.in/check.v1 v1.0.0-20200227125254-8fa46927fb4f // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,322 @@
+// keyspecgen generate the key spec table of the prefix hook from a vendored copy of the redis src/commands/*.json.
+//
+//	go run ./internal/keyspecgen -commands internal/keyspecgen/commands -out keyspec_gen.go -test keyspec_gen_test.go
+//
+// the table holds the commands with keys, and the list of the keyless commands. a container whose subcommands have keys is in neither,
+// so its subcommands missing from the JSON go to the UnknownCommandPolicy, and so do the commands of unsafeCommands. the commands with a key spec redis marks unknown are
+// left out, they need a hand-written rewrite or the key spec discovery.
+// the test file checks every command of redis.Cmdable is either keyless or has key specs
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// command the fields of a redis commands JSON entry the generator reads
+type command struct {
+	Container string    `json:"container"`
+	KeySpecs  []keySpec `json:"key_specs"`
+}
+
+type keySpec struct {
+	Flags       []string `json:"flags"`
+	BeginSearch struct {
+		Index *struct {
+			Pos int `json:"pos"`
+		} `json:"index"`
+		Keyword *struct {
+			Keyword   string `json:"keyword"`
+			StartFrom int    `json:"startfrom"`
+		} `json:"keyword"`
+	} `json:"begin_search"`
+	FindKeys struct {
+		Range *struct {
+			LastKey int `json:"lastkey"`
+			Step    int `json:"step"`
+			Limit   int `json:"limit"`
+		} `json:"range"`
+		KeyNum *struct {
+			KeyNumIdx int `json:"keynumidx"`
+			FirstKey  int `json:"firstkey"`
+			Step      int `json:"step"`
+		} `json:"keynum"`
+	} `json:"find_keys"`
+}
+
+func (s keySpec) hasFlag(flag string) bool {
+	for _, f := range s.Flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// literal return the KeySpec literal of the spec, ok is false when the spec is unknown
+func (s keySpec) literal() (string, bool) {
+	var fields []string
+	field := func(name string, value interface{}) {
+		switch v := value.(type) {
+		case int:
+			if v != 0 {
+				fields = append(fields, fmt.Sprintf("%s: %d", name, v))
+			}
+		case string:
+			if v != "" {
+				fields = append(fields, fmt.Sprintf("%s: %q", name, v))
+			}
+		case bool:
+			if v {
+				fields = append(fields, name+": true")
+			}
+		}
+	}
+
+	switch begin := s.BeginSearch; {
+	case begin.Index != nil:
+		field("Index", begin.Index.Pos)
+	case begin.Keyword != nil:
+		field("Index", begin.Keyword.StartFrom)
+		field("Keyword", begin.Keyword.Keyword)
+	default:
+		return "", false
+	}
+	switch find := s.FindKeys; {
+	case find.Range != nil:
+		field("LastKey", find.Range.LastKey)
+		if find.Range.Step != 1 {
+			field("Step", find.Range.Step)
+		}
+		field("Limit", find.Range.Limit)
+	case find.KeyNum != nil:
+		field("KeyNum", true)
+		field("KeyNumIndex", find.KeyNum.KeyNumIdx)
+		field("FirstKey", find.KeyNum.FirstKey)
+		if find.KeyNum.Step != 1 {
+			field("Step", find.KeyNum.Step)
+		}
+	default:
+		return "", false
+	}
+	return "{" + strings.Join(fields, ", ") + "}", true
+}
+
+// unsafeCommands the commands without keys which still act across the namespaces, e.g. FLUSHDB, or leak the keys of the other
+// namespaces, e.g. RANDOMKEY. they and their subcommands are never keyless, so they go to the UnknownCommandPolicy
+var unsafeCommands = map[string]bool{
+	"FLUSHDB": true, "FLUSHALL": true, "SWAPDB": true, "DEBUG": true, "SCRIPT": true, "MODULE": true, "SHUTDOWN": true,
+	"RANDOMKEY": true, "DBSIZE": true,
+}
+
+func main() {
+	dir := flag.String("commands", "internal/keyspecgen/commands", "the directory of the redis commands JSON files")
+	out := flag.String("out", "keyspec_gen.go", "the generated key spec table")
+	test := flag.String("test", "keyspec_gen_test.go", "the generated coverage test of redis.Cmdable")
+	flag.Parse()
+
+	commands, err := readCommands(*dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	specs := map[string][]string{}
+	keyless := map[string]bool{}
+	for name, cmd := range commands {
+		var literals []string
+		known := true
+		for _, spec := range cmd.KeySpecs {
+			if spec.hasFlag("NOT_KEY") {
+				continue
+			}
+			literal, ok := spec.literal()
+			if !ok {
+				known = false
+				break
+			}
+			literals = append(literals, literal)
+		}
+		switch {
+		case !known:
+		case len(literals) > 0:
+			specs[name] = literals
+		default:
+			keyless[name] = true
+		}
+	}
+	for _, cmd := range commands {
+		if cmd.Container != "" {
+			// the container only holds its subcommands, e.g. XINFO
+			delete(keyless, cmd.Container)
+		}
+	}
+	for name := range keyless {
+		if unsafeCommands[strings.SplitN(name, "|", 2)[0]] {
+			delete(keyless, name)
+		}
+	}
+
+	if err := write(*out, genTable(specs, keyless)); err != nil {
+		log.Fatal(err)
+	}
+	if err := write(*test, genTest()); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// readCommands read the JSON files of the directory, a subcommand is named like "XINFO|STREAM"
+func readCommands(dir string) (map[string]command, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	commands := map[string]command{}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var doc map[string]command
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		for name, cmd := range doc {
+			if cmd.Container != "" {
+				name = cmd.Container + "|" + name
+			}
+			commands[strings.ToUpper(name)] = cmd
+		}
+	}
+	return commands, nil
+}
+
+const header = "// Code generated by keyspecgen from internal/keyspecgen/commands; DO NOT EDIT.\n\npackage prefix\n\n"
+
+const testImports = `import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/cast"
+	"github.com/stretchr/testify/assert"
+)
+
+`
+
+func genTable(specs map[string][]string, keyless map[string]bool) []byte {
+	var b bytes.Buffer
+	b.WriteString(header)
+	b.WriteString("// generatedKeySpecs the key specs of the redis commands with keys, a subcommand is named like \"XINFO|STREAM\"\n")
+	b.WriteString("var generatedKeySpecs = map[string][]KeySpec{\n")
+	for _, name := range sortedKeys(specs) {
+		fmt.Fprintf(&b, "%q: {%s},\n", name, strings.Join(specs[name], ", "))
+	}
+	b.WriteString("}\n\n")
+	b.WriteString("// generatedKeylessCommands the redis commands without keys, a container is keyless when all its subcommands are\n")
+	b.WriteString("var generatedKeylessCommands = []string{\n")
+	for _, name := range sortedKeys(keyless) {
+		fmt.Fprintf(&b, "%q,\n", name)
+	}
+	b.WriteString("}\n")
+	return b.Bytes()
+}
+
+func genTest() []byte {
+	var b bytes.Buffer
+	b.WriteString(header)
+	b.WriteString(testImports)
+	b.WriteString(coverageTest)
+	return b.Bytes()
+}
+
+// coverageTest call every method of redis.Cmdable through the hook, and fail on a command which is neither registered with key specs
+// nor as keyless, unless it is a module command or listed in the hand-written uncoveredCommands
+const coverageTest = `
+func TestCmdableCoverage(t *testing.T) {
+	var sent [][]interface{}
+	cli := redis.NewClient(&redis.Options{Addr: "127.0.0.1:0"})
+	cli.AddHook(stubHook{sent: &[][]string{}, reply: func(cmd redis.Cmder) {
+		sent = append(sent, cmd.Args())
+	}})
+
+	cmdable := reflect.TypeOf((*redis.Cmdable)(nil)).Elem()
+	for i := 0; i < cmdable.NumMethod(); i++ {
+		method := reflect.ValueOf(cli).MethodByName(cmdable.Method(i).Name)
+		sent = nil
+		if !callWithZeroArgs(method) {
+			continue
+		}
+		for _, args := range sent {
+			name := strings.ToUpper(cast.ToString(args[0]))
+			full := name
+			if len(args) > 1 {
+				full += "|" + strings.ToUpper(cast.ToString(args[1]))
+			}
+			if strings.Contains(name, ".") {
+				continue
+			}
+			_, known := lookupCommand(args)
+			if _, uncovered := uncoveredCommands[name]; uncovered {
+				assert.False(t, known, "%s is covered, remove it from uncoveredCommands", name)
+				continue
+			}
+			assert.True(t, known, "%s sends %s which has no key spec", cmdable.Method(i).Name, full)
+		}
+	}
+}
+
+// callWithZeroArgs call the method with zero values, false when go-redis panics on them
+func callWithZeroArgs(method reflect.Value) (ok bool) {
+	defer func() {
+		ok = recover() == nil
+	}()
+	typ := method.Type()
+	var args []reflect.Value
+	for i := 0; i < typ.NumIn(); i++ {
+		in := typ.In(i)
+		switch {
+		case typ.IsVariadic() && i == typ.NumIn()-1:
+			args = append(args, reflect.MakeSlice(in, 0, 0))
+		case in == reflect.TypeOf((*context.Context)(nil)).Elem():
+			args = append(args, reflect.ValueOf(context.Background()))
+		case in.Kind() == reflect.Ptr:
+			args = append(args, reflect.New(in.Elem()))
+		default:
+			args = append(args, reflect.Zero(in))
+		}
+	}
+	if typ.IsVariadic() {
+		method.CallSlice(args)
+	} else {
+		method.Call(args)
+	}
+	return true
+}
+`
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func write(path string, src []byte) error {
+	formatted, err := format.Source(src)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return os.WriteFile(path, formatted, 0o644)
+}
@@ -0,0 +1,210 @@
+package prefix
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cast"
+)
+
+// KeySpec describe where the `key` arguments of a command are, it follows the key specs of the redis COMMAND reply:
+// the begin search find the first key (by Index, or after a Keyword), then the find keys find the rest (by range, or by a numkeys argument).
+// the helpers KeyAt, KeyRange, NumKeys and KeywordKeys build the common specs
+type KeySpec struct {
+	// Index is the position of the first key, the command name is at 0.
+	// with a Keyword, it is the position the search for the keyword starts from, a negative one searches backward from the end
+	Index int
+	// Keyword the keys begin after this keyword, there are no keys when it is absent
+	Keyword string
+
+	// LastKey is the last key relative to the begin, 0 means a single key, a negative one counts from the end of the args (-1 is the last arg)
+	LastKey int
+	// Step between two keys, 1 when it is 0
+	Step int
+	// Limit > 1 with a negative LastKey means only 1/Limit of the args after the begin are keys, e.g. XREAD ... STREAMS key key id id
+	Limit int
+
+	// KeyNum means the number of keys is given by the argument at KeyNumIndex, the keys start at FirstKey, both relative to the begin
+	KeyNum      bool
+	KeyNumIndex int
+	FirstKey    int
+
+	// Pattern means the keys are glob patterns, e.g. KEYS pattern, the prefix is glob-escaped before it is added
+	Pattern bool
+
+	// unknown spec of the server, the keys can only be found with COMMAND GETKEYS
+	unknown bool
+}
+
+// KeyAt the key at a fixed position, e.g. GET key -> KeyAt(1)
+func KeyAt(index int) KeySpec {
+	return KeySpec{Index: index}
+}
+
+// KeyRange the keys from first to last every step, a negative last counts from the end of the args,
+// e.g. MSET key value [key value ...] -> KeyRange(1, -1, 2), BLPOP key [key ...] timeout -> KeyRange(1, -2, 1)
+func KeyRange(first, last, step int) KeySpec {
+	spec := KeySpec{Index: first, LastKey: last, Step: step}
+	if last >= 0 {
+		spec.LastKey = last - first
+	}
+	return spec
+}
+
+// NumKeys the keys after the numkeys argument at index, every step, e.g. EVAL script numkeys [key ...] -> NumKeys(2, 1)
+func NumKeys(index, step int) KeySpec {
+	return KeySpec{Index: index, KeyNum: true, FirstKey: 1, Step: step}
+}
+
+// KeywordKeys the count keys after the first keyword found from the position start, a count <= 0 means all the args after the keyword,
+// e.g. SORT key ... STORE destination -> KeywordKeys("STORE", 2, 1)
+func KeywordKeys(keyword string, start, count int) KeySpec {
+	spec := KeySpec{Index: start, Keyword: keyword, LastKey: count - 1}
+	if count <= 0 {
+		spec.LastKey = -1
+	}
+	return spec
+}
+
+// positions return the positions of the `key` args, err tells why the args do not fit the spec
+func (s KeySpec) positions(args []interface{}) (positions []int, err error) {
+	begin := s.Index
+	if s.Keyword != "" {
+		if begin = s.searchKeyword(args); begin < 0 {
+			// no keyword, no keys
+			return nil, nil
+		}
+	}
+
+	step := s.Step
+	if step < 1 {
+		step = 1
+	}
+	first, last := begin, begin
+	switch {
+	case s.KeyNum:
+		if begin+s.KeyNumIndex < 1 || begin+s.KeyNumIndex >= len(args) {
+			return nil, fmt.Errorf("missing numkeys at %d", begin+s.KeyNumIndex)
+		}
+		numKeys, err := strconv.Atoi(cast.ToString(args[begin+s.KeyNumIndex]))
+		if err != nil || numKeys < 0 {
+			return nil, fmt.Errorf("numkeys %q is not a number of keys", cast.ToString(args[begin+s.KeyNumIndex]))
+		}
+		if numKeys > len(args) {
+			return nil, fmt.Errorf("numkeys %d exceeds the %d arguments", numKeys, len(args))
+		}
+		first = begin + s.FirstKey
+		last = first + (numKeys-1)*step
+	case s.LastKey >= 0:
+		last = first + s.LastKey
+	case s.Limit <= 1:
+		last = len(args) + s.LastKey
+	default:
+		last = first + (len(args)-first)/s.Limit + s.LastKey
+	}
+
+	for i := first; i <= last; i += step {
+		if i < 1 || i >= len(args) {
+			return nil, fmt.Errorf("missing key at %d, %d arguments", i, len(args))
+		}
+		positions = append(positions, i)
+	}
+	return positions, nil
+}
+
+// searchKeyword return the position after the keyword, or -1 when the keyword is absent
+func (s KeySpec) searchKeyword(args []interface{}) int {
+	if s.Index >= 0 {
+		for i := max(s.Index, 1); i < len(args); i++ {
+			if strings.EqualFold(cast.ToString(args[i]), s.Keyword) {
+				return i + 1
+			}
+		}
+		return -1
+	}
+	for i := len(args) + s.Index; i >= 1; i-- {
+		if strings.EqualFold(cast.ToString(args[i]), s.Keyword) {
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// keyPrefixes return the prefixes of the `key` args found by the specs by their positions, and the positions of the patterns
+func keyPrefixes(args []interface{}, specs []KeySpec, prefix string) (map[int]string, map[int]bool, error) {
+	prefixes := map[int]string{}
+	patterns := map[int]bool{}
+	for _, spec := range specs {
+		positions, err := spec.positions(args)
+		if err != nil {
+			return nil, nil, arityError(args, err.Error())
+		}
+		for _, i := range positions {
+			if spec.Pattern {
+				prefixes[i] = escapeGlob(prefix)
+				patterns[i] = true
+			} else {
+				prefixes[i] = prefix
+			}
+		}
+	}
+	return prefixes, patterns, nil
+}
+
+// commandEntry is how the hook prefixes a command: by its key specs, or by a built-in rewrite for the commands key specs can not describe
+type commandEntry struct {
+	specs   []KeySpec
+	rewrite func(args []interface{}, prefix string) (prefixes map[int]string, patterns map[int]bool, err error)
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]commandEntry{}
+)
+
+// RegisterCommand register the key specs of a command, e.g. an in-house module command or a command the hook does not know yet.
+// it replaces the built-in specs of the command, a command registered without specs is keyless.
+// a subcommand is registered as "NAME|SUBCOMMAND", e.g. "XINFO|STREAM", and takes precedence over its container command
+func RegisterCommand(name string, specs ...KeySpec) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[strings.ToUpper(name)] = commandEntry{specs: specs}
+}
+
+// lookupCommand return the registered command of the args, the subcommand first
+func lookupCommand(args []interface{}) (commandEntry, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	name := strings.ToUpper(cast.ToString(args[0]))
+	if len(args) > 1 {
+		if entry, ok := registry[name+"|"+strings.ToUpper(cast.ToString(args[1]))]; ok {
+			return entry, true
+		}
+	}
+	entry, ok := registry[name]
+	return entry, ok
+}
+
+//go:generate go run ./internal/keyspecgen -commands internal/keyspecgen/commands -out keyspec_gen.go -test keyspec_gen_test.go
+
+// the built-in commands, the key specs come from the redis commands JSON, see generatedKeySpecs and generatedKeylessCommands
+func init() {
+	for name, specs := range generatedKeySpecs {
+		RegisterCommand(name, specs...)
+	}
+	// the keyless commands never trigger the UnknownCommandPolicy
+	for _, name := range generatedKeylessCommands {
+		RegisterCommand(name)
+	}
+	RegisterCommand("KEYS", KeySpec{Index: 1, Pattern: true}) // KEYS pattern
+	// SCAN is sent as a scoped copy, see scopedScanCmd
+	RegisterCommand("SCAN")
+	// DEBUG has no key specs, but DEBUG OBJECT key reads a key
+	RegisterCommand("DEBUG|OBJECT", KeyAt(2))
+	// the key specs of SORT, SORT_RO and MIGRATE are unknown or incomplete
+	registry["SORT"] = commandEntry{rewrite: rewriteSort}
+	registry["SORT_RO"] = commandEntry{rewrite: rewriteSort}
+	registry["MIGRATE"] = commandEntry{rewrite: rewriteMigrate}
+}
@@ -0,0 +1,250 @@
+// Code generated by keyspecgen from internal/keyspecgen/commands; DO NOT EDIT.
+
+package prefix
+
+// generatedKeySpecs the key specs of the redis commands with keys, a subcommand is named like "XINFO|STREAM"
+var generatedKeySpecs = map[string][]KeySpec{
+	"APPEND":                {{Index: 1}},
+	"BITCOUNT":              {{Index: 1}},
+	"BITFIELD":              {{Index: 1}},
+	"BITFIELD_RO":           {{Index: 1}},
+	"BITOP":                 {{Index: 2}, {Index: 3, LastKey: -1}},
+	"BITPOS":                {{Index: 1}},
+	"BLMOVE":                {{Index: 1}, {Index: 2}},
+	"BLMPOP":                {{Index: 2, KeyNum: true, FirstKey: 1}},
+	"BLPOP":                 {{Index: 1, LastKey: -2}},
+	"BRPOP":                 {{Index: 1, LastKey: -2}},
+	"BRPOPLPUSH":            {{Index: 1}, {Index: 2}},
+	"BZMPOP":                {{Index: 2, KeyNum: true, FirstKey: 1}},
+	"BZPOPMAX":              {{Index: 1, LastKey: -2}},
+	"BZPOPMIN":              {{Index: 1, LastKey: -2}},
+	"COPY":                  {{Index: 1}, {Index: 2}},
+	"DECR":                  {{Index: 1}},
+	"DECRBY":                {{Index: 1}},
+	"DEL":                   {{Index: 1, LastKey: -1}},
+	"DUMP":                  {{Index: 1}},
+	"EVAL":                  {{Index: 2, KeyNum: true, FirstKey: 1}},
+	"EVALSHA":               {{Index: 2, KeyNum: true, FirstKey: 1}},
+	"EVALSHA_RO":            {{Index: 2, KeyNum: true, FirstKey: 1}},
+	"EVAL_RO":               {{Index: 2, KeyNum: true, FirstKey: 1}},
+	"EXISTS":                {{Index: 1, LastKey: -1}},
+	"EXPIRE":                {{Index: 1}},
+	"EXPIREAT":              {{Index: 1}},
+	"EXPIRETIME":            {{Index: 1}},
+	"FCALL":                 {{Index: 2, KeyNum: true, FirstKey: 1}},
+	"FCALL_RO":              {{Index: 2, KeyNum: true, FirstKey: 1}},
+	"GEOADD":                {{Index: 1}},
+	"GEODIST":               {{Index: 1}},
+	"GEOHASH":               {{Index: 1}},
+	"GEOPOS":                {{Index: 1}},
+	"GEORADIUS":             {{Index: 1}, {Index: 6, Keyword: "STORE"}, {Index: 6, Keyword: "STOREDIST"}},
+	"GEORADIUSBYMEMBER":     {{Index: 1}, {Index: 5, Keyword: "STORE"}, {Index: 5, Keyword: "STOREDIST"}},
+	"GEORADIUSBYMEMBER_RO":  {{Index: 1}},
+	"GEORADIUS_RO":          {{Index: 1}},
+	"GEOSEARCH":             {{Index: 1}},
+	"GEOSEARCHSTORE":        {{Index: 1}, {Index: 2}},
+	"GET":                   {{Index: 1}},
+	"GETBIT":                {{Index: 1}},
+	"GETDEL":                {{Index: 1}},
+	"GETEX":                 {{Index: 1}},
+	"GETRANGE":              {{Index: 1}},
+	"GETSET":                {{Index: 1}},
+	"HDEL":                  {{Index: 1}},
+	"HEXISTS":               {{Index: 1}},
+	"HEXPIRE":               {{Index: 1}},
+	"HEXPIREAT":             {{Index: 1}},
+	"HEXPIRETIME":           {{Index: 1}},
+	"HGET":                  {{Index: 1}},
+	"HGETALL":               {{Index: 1}},
+	"HINCRBY":               {{Index: 1}},
+	"HINCRBYFLOAT":          {{Index: 1}},
+	"HKEYS":                 {{Index: 1}},
+	"HLEN":                  {{Index: 1}},
+	"HMGET":                 {{Index: 1}},
+	"HMSET":                 {{Index: 1}},
+	"HPERSIST":              {{Index: 1}},
+	"HPEXPIRE":              {{Index: 1}},
+	"HPEXPIREAT":            {{Index: 1}},
+	"HPEXPIRETIME":          {{Index: 1}},
+	"HPTTL":                 {{Index: 1}},
+	"HRANDFIELD":            {{Index: 1}},
+	"HSCAN":                 {{Index: 1}},
+	"HSET":                  {{Index: 1}},
+	"HSETNX":                {{Index: 1}},
+	"HSTRLEN":               {{Index: 1}},
+	"HTTL":                  {{Index: 1}},
+	"HVALS":                 {{Index: 1}},
+	"INCR":                  {{Index: 1}},
+	"INCRBY":                {{Index: 1}},
+	"INCRBYFLOAT":           {{Index: 1}},
+	"LCS":                   {{Index: 1, LastKey: 1}},
+	"LINDEX":                {{Index: 1}},
+	"LINSERT":               {{Index: 1}},
+	"LLEN":                  {{Index: 1}},
+	"LMOVE":                 {{Index: 1}, {Index: 2}},
+	"LMPOP":                 {{Index: 1, KeyNum: true, FirstKey: 1}},
+	"LPOP":                  {{Index: 1}},
+	"LPOS":                  {{Index: 1}},
+	"LPUSH":                 {{Index: 1}},
+	"LPUSHX":                {{Index: 1}},
+	"LRANGE":                {{Index: 1}},
+	"LREM":                  {{Index: 1}},
+	"LSET":                  {{Index: 1}},
+	"LTRIM":                 {{Index: 1}},
+	"MEMORY|USAGE":          {{Index: 2}},
+	"MGET":                  {{Index: 1, LastKey: -1}},
+	"MIGRATE":               {{Index: 3}, {Index: -2, Keyword: "KEYS", LastKey: -1}},
+	"MOVE":                  {{Index: 1}},
+	"MSET":                  {{Index: 1, LastKey: -1, Step: 2}},
+	"MSETNX":                {{Index: 1, LastKey: -1, Step: 2}},
+	"OBJECT|ENCODING":       {{Index: 2}},
+	"OBJECT|FREQ":           {{Index: 2}},
+	"OBJECT|IDLETIME":       {{Index: 2}},
+	"OBJECT|REFCOUNT":       {{Index: 2}},
+	"PERSIST":               {{Index: 1}},
+	"PEXPIRE":               {{Index: 1}},
+	"PEXPIREAT":             {{Index: 1}},
+	"PEXPIRETIME":           {{Index: 1}},
+	"PFADD":                 {{Index: 1}},
+	"PFCOUNT":               {{Index: 1, LastKey: -1}},
+	"PFMERGE":               {{Index: 1}, {Index: 2, LastKey: -1}},
+	"PSETEX":                {{Index: 1}},
+	"PTTL":                  {{Index: 1}},
+	"RENAME":                {{Index: 1}, {Index: 2}},
+	"RENAMENX":              {{Index: 1}, {Index: 2}},
+	"RESTORE":               {{Index: 1}},
+	"RPOP":                  {{Index: 1}},
+	"RPOPLPUSH":             {{Index: 1}, {Index: 2}},
+	"RPUSH":                 {{Index: 1}},
+	"RPUSHX":                {{Index: 1}},
+	"SADD":                  {{Index: 1}},
+	"SCARD":                 {{Index: 1}},
+	"SDIFF":                 {{Index: 1, LastKey: -1}},
+	"SDIFFSTORE":            {{Index: 1}, {Index: 2, LastKey: -1}},
+	"SET":                   {{Index: 1}},
+	"SETBIT":                {{Index: 1}},
+	"SETEX":                 {{Index: 1}},
+	"SETNX":                 {{Index: 1}},
+	"SETRANGE":              {{Index: 1}},
+	"SINTER":                {{Index: 1, LastKey: -1}},
+	"SINTERCARD":            {{Index: 1, KeyNum: true, FirstKey: 1}},
+	"SINTERSTORE":           {{Index: 1}, {Index: 2, LastKey: -1}},
+	"SISMEMBER":             {{Index: 1}},
+	"SMEMBERS":              {{Index: 1}},
+	"SMISMEMBER":            {{Index: 1}},
+	"SMOVE":                 {{Index: 1}, {Index: 2}},
+	"SPOP":                  {{Index: 1}},
+	"SRANDMEMBER":           {{Index: 1}},
+	"SREM":                  {{Index: 1}},
+	"SSCAN":                 {{Index: 1}},
+	"STRLEN":                {{Index: 1}},
+	"SUNION":                {{Index: 1, LastKey: -1}},
+	"SUNIONSTORE":           {{Index: 1}, {Index: 2, LastKey: -1}},
+	"TOUCH":                 {{Index: 1, LastKey: -1}},
+	"TTL":                   {{Index: 1}},
+	"TYPE":                  {{Index: 1}},
+	"UNLINK":                {{Index: 1, LastKey: -1}},
+	"WATCH":                 {{Index: 1, LastKey: -1}},
+	"XACK":                  {{Index: 1}},
+	"XADD":                  {{Index: 1}},
+	"XAUTOCLAIM":            {{Index: 1}},
+	"XCLAIM":                {{Index: 1}},
+	"XDEL":                  {{Index: 1}},
+	"XGROUP|CREATE":         {{Index: 2}},
+	"XGROUP|CREATECONSUMER": {{Index: 2}},
+	"XGROUP|DELCONSUMER":    {{Index: 2}},
+	"XGROUP|DESTROY":        {{Index: 2}},
+	"XGROUP|SETID":          {{Index: 2}},
+	"XINFO|CONSUMERS":       {{Index: 2}},
+	"XINFO|GROUPS":          {{Index: 2}},
+	"XINFO|STREAM":          {{Index: 2}},
+	"XLEN":                  {{Index: 1}},
+	"XPENDING":              {{Index: 1}},
+	"XRANGE":                {{Index: 1}},
+	"XREAD":                 {{Index: 1, Keyword: "STREAMS", LastKey: -1, Limit: 2}},
+	"XREADGROUP":            {{Index: 4, Keyword: "STREAMS", LastKey: -1, Limit: 2}},
+	"XREVRANGE":             {{Index: 1}},
+	"XSETID":                {{Index: 1}},
+	"XTRIM":                 {{Index: 1}},
+	"ZADD":                  {{Index: 1}},
+	"ZCARD":                 {{Index: 1}},
+	"ZCOUNT":                {{Index: 1}},
+	"ZDIFF":                 {{Index: 1, KeyNum: true, FirstKey: 1}},
+	"ZDIFFSTORE":            {{Index: 1}, {Index: 2, KeyNum: true, FirstKey: 1}},
+	"ZINCRBY":               {{Index: 1}},
+	"ZINTER":                {{Index: 1, KeyNum: true, FirstKey: 1}},
+	"ZINTERCARD":            {{Index: 1, KeyNum: true, FirstKey: 1}},
+	"ZINTERSTORE":           {{Index: 1}, {Index: 2, KeyNum: true, FirstKey: 1}},
+	"ZLEXCOUNT":             {{Index: 1}},
+	"ZMPOP":                 {{Index: 1, KeyNum: true, FirstKey: 1}},
+	"ZMSCORE":               {{Index: 1}},
+	"ZPOPMAX":               {{Index: 1}},
+	"ZPOPMIN":               {{Index: 1}},
+	"ZRANDMEMBER":           {{Index: 1}},
+	"ZRANGE":                {{Index: 1}},
+	"ZRANGEBYLEX":           {{Index: 1}},
+	"ZRANGEBYSCORE":         {{Index: 1}},
+	"ZRANGESTORE":           {{Index: 1}, {Index: 2}},
+	"ZRANK":                 {{Index: 1}},
+	"ZREM":                  {{Index: 1}},
+	"ZREMRANGEBYLEX":        {{Index: 1}},
+	"ZREMRANGEBYRANK":       {{Index: 1}},
+	"ZREMRANGEBYSCORE":      {{Index: 1}},
+	"ZREVRANGE":             {{Index: 1}},
+	"ZREVRANGEBYLEX":        {{Index: 1}},
+	"ZREVRANGEBYSCORE":      {{Index: 1}},
+	"ZREVRANK":              {{Index: 1}},
+	"ZSCAN":                 {{Index: 1}},
+	"ZSCORE":                {{Index: 1}},
+	"ZUNION":                {{Index: 1, KeyNum: true, FirstKey: 1}},
+	"ZUNIONSTORE":           {{Index: 1}, {Index: 2, KeyNum: true, FirstKey: 1}},
+}
+
+// generatedKeylessCommands the redis commands without keys, a container is keyless when all its subcommands are
+var generatedKeylessCommands = []string{
+	"ACL",
+	"AUTH",
+	"BGREWRITEAOF",
+	"BGSAVE",
+	"CLIENT",
+	"CLUSTER",
+	"COMMAND",
+	"CONFIG",
+	"DISCARD",
+	"ECHO",
+	"EXEC",
+	"FUNCTION",
+	"HELLO",
+	"INFO",
+	"KEYS",
+	"LASTSAVE",
+	"LATENCY",
+	"MEMORY|DOCTOR",
+	"MEMORY|HELP",
+	"MEMORY|MALLOC-STATS",
+	"MEMORY|PURGE",
+	"MEMORY|STATS",
+	"MULTI",
+	"OBJECT|HELP",
+	"PING",
+	"PUBLISH",
+	"PUBSUB",
+	"QUIT",
+	"READONLY",
+	"READWRITE",
+	"REPLICAOF",
+	"RESET",
+	"ROLE",
+	"SAVE",
+	"SCAN",
+	"SELECT",
+	"SLAVEOF",
+	"SLOWLOG",
+	"SPUBLISH",
+	"TIME",
+	"UNWATCH",
+	"WAIT",
+	"WAITAOF",
+	"XGROUP|HELP",
+	"XINFO|HELP",
+}
@@ -0,0 +1,97 @@
+package prefix
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeySpecPositions(t *testing.T) {
+	tests := []struct {
+		name      string
+		spec      KeySpec
+		args      []interface{}
+		positions []int
+		ok        bool
+	}{
+		{"single", KeySpec{Index: 1}, []interface{}{"get", "k"}, []int{1}, true},
+		{"single missing", KeySpec{Index: 1}, []interface{}{"get"}, nil, false},
+		{"all but last", KeySpec{Index: 1, LastKey: -2}, []interface{}{"blpop", "k1", "k2", 0}, []int{1, 2}, true},
+		{"step", KeySpec{Index: 1, LastKey: -1, Step: 2}, []interface{}{"mset", "k1", "v1", "k2", "v2"}, []int{1, 3}, true},
+		{"keyword absent", KeySpec{Index: 1, Keyword: "STORE"}, []interface{}{"sort", "k"}, nil, true},
+		{"keyword backward", KeySpec{Index: -2, Keyword: "KEYS", LastKey: -1}, []interface{}{"migrate", "h", "p", "", 0, 0, "keys", "k1", "k2"}, []int{7, 8}, true},
+		{"keynum", KeySpec{Index: 1, KeyNum: true, FirstKey: 1}, []interface{}{"zdiff", 2, "k1", "k2"}, []int{2, 3}, true},
+		{"keynum zero", KeySpec{Index: 1, KeyNum: true, FirstKey: 1}, []interface{}{"zdiff", 0}, nil, true},
+		{"keynum too large", KeySpec{Index: 1, KeyNum: true, FirstKey: 1}, []interface{}{"zdiff", 3, "k1"}, nil, false},
+		{"keynum not a number", KeySpec{Index: 1, KeyNum: true, FirstKey: 1}, []interface{}{"zdiff", "x", "k1"}, nil, false},
+		{"keynum overflow", KeySpec{Index: 1, KeyNum: true, FirstKey: 1, Step: 2}, []interface{}{"zdiff", "9223372036854775807", "k1"}, nil, false},
+		{"keynum missing", KeySpec{Index: 2, KeyNum: true, FirstKey: 1}, []interface{}{"eval", "script"}, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			positions, err := tt.spec.positions(tt.args)
+			assert.Equal(t, tt.ok, err == nil)
+			assert.Equal(t, tt.positions, positions)
+		})
+	}
+}
+
+func TestRegisterCommand(t *testing.T) {
+	prefix := "prefix4key:"
+	ctx := context.Background()
+	Cli, sent := newStubClient(AppPrefixHook{Prefix: prefix, UnknownCommandPolicy: UnknownCommandReject}, nil)
+
+	RegisterCommand("mymod.set", KeyAt(1))
+	RegisterCommand("mymod.mget", KeyRange(2, -1, 1))
+	RegisterCommand("mymod.merge", KeyAt(1), NumKeys(2, 2))
+	RegisterCommand("mymod.query", KeyAt(1), KeywordKeys("INTO", 2, 1))
+	RegisterCommand("mymod.admin")
+	RegisterCommand("mymod.info|key", KeyAt(2))
+	RegisterCommand("mymod.info")
+
+	tests := []struct {
+		name     string
+		args     []interface{}
+		expected []string
+	}{
+		{"fixed position", []interface{}{"mymod.set", "key", "value"}, []string{"mymod.set", prefix + "key", "value"}},
+		{"range", []interface{}{"mymod.mget", "opt", "key1", "key2"}, []string{"mymod.mget", "opt", prefix + "key1", prefix + "key2"}},
+		{"numkeys with step", []interface{}{"mymod.merge", "dest", 2, "key1", "w1", "key2", "w2"},
+			[]string{"mymod.merge", prefix + "dest", "2", prefix + "key1", "w1", prefix + "key2", "w2"}},
+		{"keyword", []interface{}{"mymod.query", "key", "filter", "into", "dest"}, []string{"mymod.query", prefix + "key", "filter", "into", prefix + "dest"}},
+		{"keyword absent", []interface{}{"mymod.query", "key", "filter"}, []string{"mymod.query", prefix + "key", "filter"}},
+		{"keyless", []interface{}{"mymod.admin", "reload"}, []string{"mymod.admin", "reload"}},
+		{"subcommand", []interface{}{"mymod.info", "key", "key1"}, []string{"mymod.info", "key", prefix + "key1"}},
+		{"keyless subcommand", []interface{}{"mymod.info", "help"}, []string{"mymod.info", "help"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*sent = nil
+			assert.NoError(t, Cli.Do(ctx, tt.args...).Err())
+			assert.Equal(t, [][]string{tt.expected}, *sent)
+		})
+	}
+
+	t.Run("override built-in", func(t *testing.T) {
+		defer RegisterCommand("GETRANGE", KeyAt(1))
+		RegisterCommand("GETRANGE")
+		*sent = nil
+		Cli.GetRange(ctx, "key", 0, -1)
+		assert.Equal(t, [][]string{{"getrange", "key", "0", "-1"}}, *sent)
+	})
+}
+
+// uncoveredCommands the commands of redis.Cmdable without key specs yet, the hook sends them by the UnknownCommandPolicy
+var uncoveredCommands = map[string]string{
+	"TFCALL":      "RedisGears module commands, not in the commands JSON",
+	"TFCALLASYNC": "RedisGears module commands, not in the commands JSON",
+	"TFUNCTION":   "RedisGears module commands, not in the commands JSON",
+	"FLUSHDB":     "keyless, but acts on the keys of all the namespaces",
+	"FLUSHALL":    "keyless, but acts on the keys of all the namespaces",
+	"SCRIPT":      "keyless, but the scripts are shared by all the namespaces",
+	"MODULE":      "keyless, but the modules are shared by all the namespaces",
+	"SHUTDOWN":    "keyless, but stops the server of all the namespaces",
+	"RANDOMKEY":   "keyless, but returns the keys of the other namespaces",
+	"DBSIZE":      "keyless, but counts the keys of all the namespaces",
+}
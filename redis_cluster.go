@@ -2,12 +2,16 @@ package prefix
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net"
+	"reflect"
+	"runtime"
 	"strings"
+	"sync"
 
 	"github.com/redis/go-redis/v9"
-	"github.com/samber/lo"
 	"github.com/spf13/cast"
 )
 
@@ -16,34 +20,167 @@ type contextKey string
 // global flag in the hook function
 const skipPrefixKey contextKey = "skip"
 
+// the prefix of a single request
+const prefixKey contextKey = "prefix"
+
+// the commands are being prefixed by an outer hook, e.g. the hook is registered on a client and again on its Conn
+const rewritingKey contextKey = "rewriting"
+
 // WithSkipPrefix define a context helper function, when a key does not need a prefix, use this function, example: Cli.Set(WithSkipPrefix(ctx), "key", "value")
 func WithSkipPrefix(ctx context.Context) context.Context {
 	return context.WithValue(ctx, skipPrefixKey, true)
 }
 
+// WithPrefix define a context helper function, the commands run with this context use the given prefix instead of the one of the hook, example: Cli.Set(WithPrefix(ctx, "tenant42:"), "key", "value")
+func WithPrefix(ctx context.Context, prefix string) context.Context {
+	return context.WithValue(ctx, prefixKey, prefix)
+}
+
+// SkipPrefix mark the cmd to be sent without prefix, unlike WithSkipPrefix it works on a single command queued in a pipeline,
+// whose commands all run with the context of the pipeline, example: flags := SkipPrefix(pipe.HGetAll(ctx, "feature-flags")).
+// the cmd must be a command as go-redis allocates it, e.g. returned by a method of the client or by redis.NewStringCmd: the mark is
+// dropped by a finalizer, and the runtime crashes the process on the address of a command embedded in a struct, e.g. &wrapper.StringCmd
+func SkipPrefix[T redis.Cmder](cmd T) T {
+	addr := reflect.ValueOf(cmd).Pointer()
+	if _, marked := skippedCmds.LoadOrStore(addr, struct{}{}); !marked {
+		// the mark is dropped with the cmd, the table does not keep it alive
+		runtime.SetFinalizer(cmd, func(interface{}) { skippedCmds.Delete(addr) })
+	}
+	return cmd
+}
+
+// skippedCmds the addresses of the commands marked by SkipPrefix. the args are left as they are: go-redis reads them back,
+// e.g. the ScanIterator switches on the command name to find the cursor of the next page
+var skippedCmds sync.Map
+
+// skipped report whether the cmd is marked by SkipPrefix
+func skipped(cmd redis.Cmder) bool {
+	_, ok := skippedCmds.Load(reflect.ValueOf(cmd).Pointer())
+	return ok
+}
+
 func shouldSkipPrefix(ctx context.Context) bool {
 	value := ctx.Value(skipPrefixKey)
 	skip, ok := value.(bool)
 	return ok && skip
 }
 
-// allow prefix single `key` command
-var commandsWithPrefix = []string{
-	"GET", "SET", "APPEND", "GETRANGE", "SETRANGE", "STRLEN", "GETSET", "SETNX", "SETEX", "PSETEX", "GETBIT", "SETBIT", "BITCOUNT", "BITPOS", "BITFIELD",
-	"RPUSH", "LPOP", "RPOP", "LLEN", "LRANGE", "LPUSH", "LINDEX", "LSET", "LINSERT", "LREM", "LTRIM",
-	"SADD", "SREM", "SISMEMBER", "SMEMBERS", "SCARD", "SPOP", "SRANDMEMBER",
-	"HSET", "HMSET", "HGET", "HGETALL", "HVALS", "HLEN", "HEXISTS", "HDEL", "HKEYS", "HINCRBY", "HINCRBYFLOAT", "HSCAN", "HSTRLEN",
-	"ZADD", "ZRANGE", "ZRANGEBYSCORE", "ZREVRANGEBYSCORE", "ZREM", "ZREVRANGE", "ZCARD", "ZSCORE", "ZRANK", "ZREVRANK", "ZINCRBY", "ZRANGEBYLEX", "ZREVRANGEBYLEX",
-	"ZREMRANGEBYRANK", "ZREMRANGEBYSCORE", "ZREMRANGEBYLEX", "ZPOPMIN", "ZPOPMAX",
-	"PFADD",
-	"GEOADD", "GEOPOS", "GEODIST", "GEOSEARCH",
-	"XADD", "XLEN", "XRANGE", "XREVRANGE", "XTRIM", "XDEL",
-	"INCR", "INCRBY", "INCRBYFLOAT", "DECR", "DECRBY",
-	"WATCH", "MULTI", "EXEC", "EXPIRE", "TTL", "TYPE", "DUMP", "RESTORE",
+// UnknownCommandPolicy decide what the hook does with a command it does not know how to prefix
+type UnknownCommandPolicy int
+
+const (
+	// UnknownCommandLog send the command without prefix and log it, the default policy
+	UnknownCommandLog UnknownCommandPolicy = iota
+	// UnknownCommandReject fail the command with an *UnknownCommandError, it is never sent
+	UnknownCommandReject
+	// UnknownCommandPassThrough send the command without prefix silently
+	UnknownCommandPassThrough
+)
+
+// the reason attribute of the events written to AppPrefixHook.Logger
+const (
+	// LogReasonUnknownCommand the command is not known, see UnknownCommandPolicy
+	LogReasonUnknownCommand = "unknown command"
+	// LogReasonSkipped the command is sent without prefix because of WithSkipPrefix, logged at debug level
+	LogReasonSkipped = "skipped via context"
+	// LogReasonSkippedCmd the command is sent without prefix because of SkipPrefix, logged at debug level
+	LogReasonSkippedCmd = "skipped command"
+	// LogReasonMalformedArity the args of the command do not fit its `key` positions, the command fails with an *ArityError
+	LogReasonMalformedArity = "malformed arity"
+	// LogReasonDiscoveryFailed the key specs of the command could not be loaded from the server, see KeySpecDiscovery
+	LogReasonDiscoveryFailed = "key spec discovery failed"
+)
+
+// UnknownCommandError is the error of a command rejected by UnknownCommandReject
+type UnknownCommandError struct {
+	Command string
+}
+
+func (e *UnknownCommandError) Error() string {
+	return "redis prefix: unsupport app prefix command: " + e.Command
+}
+
+// ArityError is the error of a command whose args do not fit its `key` positions, e.g. EVAL with a numkeys larger than its keys.
+// the command is never sent
+type ArityError struct {
+	Command string
+	Reason  string
+}
+
+func (e *ArityError) Error() string {
+	return "redis prefix: malformed arguments of " + e.Command + ": " + e.Reason
+}
+
+func arityError(args []interface{}, reason string) error {
+	return &ArityError{Command: strings.ToUpper(cast.ToString(args[0])), Reason: reason}
+}
+
+// CrossSlotError is the error of a multi-key command whose prefixed keys hash to different cluster slots, the command is never sent
+type CrossSlotError struct {
+	Command string
+	// Keys the prefixed keys of the command, and Slots their slots
+	Keys  []string
+	Slots []int
+	// Colocated the keys shared a slot before they were prefixed, the prefix broke their co-location
+	Colocated bool
+}
+
+func (e *CrossSlotError) Error() string {
+	keys := make([]string, len(e.Keys))
+	for i, key := range e.Keys {
+		keys[i] = fmt.Sprintf("%s (slot %d)", key, e.Slots[i])
+	}
+	if e.Colocated {
+		return "redis prefix: the prefix moves the keys of " + e.Command + " to different slots: " + strings.Join(keys, ", ")
+	}
+	return "redis prefix: the keys of " + e.Command + " hash to different slots: " + strings.Join(keys, ", ")
 }
 
 type AppPrefixHook struct {
 	Prefix string
+
+	// PrefixFunc resolve the prefix of each request from its context, it takes the place of Prefix when set.
+	// when it returns an error, the command fails with that error instead of running without prefix
+	PrefixFunc func(ctx context.Context) (string, error)
+
+	// AllowEmptyPrefix let the commands run without prefix when PrefixFunc is set and the prefix it or WithPrefix resolves is empty,
+	// otherwise they fail with ErrEmptyPrefix instead of reaching the keys of all the namespaces
+	AllowEmptyPrefix bool
+
+	// UnknownCommandPolicy is applied to the commands which are neither known to have keys nor known to be keyless
+	UnknownCommandPolicy UnknownCommandPolicy
+
+	// Logger receive the diagnostic events of the hook, slog.Default() is used when it is nil
+	Logger *slog.Logger
+
+	// Discovery load the key specs of the commands the hook does not know from the server, it is off when nil
+	Discovery *KeySpecDiscovery
+
+	// NamespaceFunctions add the prefix to the library names of FUNCTION LOAD and to the function names of FCALL,
+	// so each namespace deploys its own version of a library. the prefix is encoded to letters, digits and underscores,
+	// and FUNCTION FLUSH, RESTORE and DUMP fail with ErrSharedFunctions
+	NamespaceFunctions bool
+
+	// HashTagPrefix make the prefix a cluster hash tag, e.g. "tenant42:" is added as "{tenant42}:", so all the keys of a namespace
+	// live in one slot and any multi-key command works. a prefix which already has a hash tag is unchanged
+	HashTagPrefix bool
+
+	// KeepKeyHashTag keep the hash tag of a key authoritative when the prefix has one: the prefix is added without its braces,
+	// e.g. "{user1}:cart" -> "tenant42:{user1}:cart", the keys without hash tag get the prefix as is
+	KeepKeyHashTag bool
+
+	// CheckCrossSlot fail a multi-key command whose prefixed keys hash to different slots with a *CrossSlotError before it is sent,
+	// instead of a CROSSSLOT error of the server. set it on the hook of a ClusterClient
+	CheckCrossSlot bool
+
+	// SplitCrossSlot send DEL, UNLINK, EXISTS, TOUCH and MGET whose prefixed keys hash to different slots as one command per slot,
+	// and merge their replies. the split commands are not atomic, and are never failed by CheckCrossSlot, except inside a transaction:
+	// there they are never split, and fail with a *CrossSlotError
+	SplitCrossSlot bool
+
+	// ExemptKeys the glob patterns of the keys shared by all the namespaces, e.g. "global:*" or "ratelimit:cfg". a key matching one
+	// of them is never prefixed, while the other keys of the same command are
+	ExemptKeys []string
 }
 
 func (h AppPrefixHook) DialHook(next redis.DialHook) redis.DialHook {
@@ -54,148 +191,406 @@ func (h AppPrefixHook) DialHook(next redis.DialHook) redis.DialHook {
 
 func (h AppPrefixHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
 	return func(ctx context.Context, cmd redis.Cmder) error {
-		if !shouldSkipPrefix(ctx) {
-			h.addPrefixToArgs(ctx, cmd)
+		if shouldSkipPrefix(ctx) {
+			h.logSkipped(ctx, cmd)
+			return next(ctx, cmd)
+		}
+		if ctx.Value(rewritingKey) != nil {
+			return next(ctx, cmd)
+		}
+		ctx = context.WithValue(ctx, rewritingKey, true)
+		prefix, err := h.resolvePrefix(ctx)
+		if err != nil {
+			cmd.SetErr(err)
+			return err
+		}
+		send := func(ctx context.Context, cmds ...redis.Cmder) error {
+			for _, cmd := range cmds {
+				if err := next(ctx, cmd); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		sent, err := h.prepareCmd(ctx, cmd, prefix, send)
+		if err != nil {
+			cmd.SetErr(err)
+			return err
+		}
+		parts := h.splitCmd(ctx, sent)
+		err = nil
+		for _, part := range parts {
+			if partErr := next(ctx, part); partErr != nil && err == nil {
+				err = partErr
+			}
 		}
-		return next(ctx, cmd)
+		mergeCmd(sent, parts)
+		h.finishCmd(cmd, sent, prefix)
+		if err == nil {
+			// e.g. the redis.Nil of a RANDOMKEY of another namespace, go-redis sets the returned error on the cmd
+			err = cmd.Err()
+		}
+		return err
 	}
 }
 
 func (h AppPrefixHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
 	return func(ctx context.Context, cmds []redis.Cmder) error {
-		if !shouldSkipPrefix(ctx) {
+		if shouldSkipPrefix(ctx) {
+			h.logSkipped(ctx, cmds...)
+			return next(ctx, cmds)
+		}
+		if ctx.Value(rewritingKey) != nil {
+			return next(ctx, cmds)
+		}
+		ctx = context.WithValue(ctx, rewritingKey, true)
+		prefix, err := h.resolvePrefix(ctx)
+		if err != nil {
 			for _, cmd := range cmds {
-				h.addPrefixToArgs(ctx, cmd)
+				cmd.SetErr(err)
+			}
+			return err
+		}
+		h := h
+		var send sendFunc
+		if isTx(cmds) {
+			// the commands split per slot would go in one MULTI/EXEC block per slot on a ClusterClient, and not be atomic anymore,
+			// they fail with a *CrossSlotError instead
+			h.CheckCrossSlot = h.CheckCrossSlot || h.SplitCrossSlot
+			h.SplitCrossSlot = false
+		} else {
+			send = func(ctx context.Context, cmds ...redis.Cmder) error {
+				return next(ctx, cmds)
 			}
 		}
-		return next(ctx, cmds)
+		prepared := make([]redis.Cmder, len(cmds))
+		parts := make([][]redis.Cmder, len(cmds))
+		sent := make([]redis.Cmder, 0, len(cmds))
+		for i, cmd := range cmds {
+			if prepared[i], err = h.prepareCmd(ctx, cmd, prefix, send); err != nil {
+				// the pipeline is sent as a whole or not at all
+				for _, cmd := range cmds {
+					cmd.SetErr(err)
+				}
+				return err
+			}
+			parts[i] = h.splitCmd(ctx, prepared[i])
+			sent = append(sent, parts[i]...)
+		}
+		err = next(ctx, sent)
+		for i, cmd := range cmds {
+			mergeCmd(prepared[i], parts[i])
+			h.finishCmd(cmd, prepared[i], prefix)
+			if err == nil {
+				// go-redis returns the first error of the cmds, e.g. the redis.Nil of a RANDOMKEY of another namespace
+				err = cmd.Err()
+			}
+		}
+		return err
 	}
 }
 
-// public prefix processing function
-func (h AppPrefixHook) addPrefixToArgs(ctx context.Context, cmd redis.Cmder) {
-	// directly change the args variable, because the memory address is the same
-	args := cmd.Args()
-	if len(args) <= 1 {
+// isTx report whether the cmds are a transaction wrapped in MULTI and EXEC, its next expects nothing else
+func isTx(cmds []redis.Cmder) bool {
+	return len(cmds) >= 2 && cmds[0].Name() == "multi" && cmds[len(cmds)-1].Name() == "exec"
+}
+
+// ErrEmptyPrefix is the error of a command whose resolved prefix is empty while PrefixFunc is set, see AllowEmptyPrefix
+var ErrEmptyPrefix = errors.New("redis prefix: the resolved prefix is empty")
+
+// resolvePrefix return the prefix of the current request: the one set by WithPrefix, then the PrefixFunc result, then the static Prefix
+func (h AppPrefixHook) resolvePrefix(ctx context.Context) (string, error) {
+	prefix, ok := ctx.Value(prefixKey).(string)
+	if !ok && h.PrefixFunc != nil {
+		var err error
+		if prefix, err = h.PrefixFunc(ctx); err != nil {
+			return "", fmt.Errorf("redis prefix: resolve prefix: %w", err)
+		}
+	} else if !ok {
+		prefix = h.Prefix
+	}
+	if prefix == "" && h.PrefixFunc != nil && !h.AllowEmptyPrefix {
+		return "", ErrEmptyPrefix
+	}
+	if h.HashTagPrefix {
+		prefix = hashTagPrefix(prefix)
+	}
+	return prefix, nil
+}
+
+// prepareCmd add the prefix to the cmd and return the command which is sent in its place, usually the cmd itself
+func (h AppPrefixHook) prepareCmd(ctx context.Context, cmd redis.Cmder, prefix string, send sendFunc) (redis.Cmder, error) {
+	if skipped(cmd) {
+		h.log(ctx, slog.LevelDebug, LogReasonSkippedCmd, strings.ToUpper(cmd.Name()), prefix)
+		return cmd, nil
+	}
+	if rewritten(cmd.Args()) {
+		// the cmd is sent again, e.g. by a retry wrapper, its args already have the prefix
+		return cmd, nil
+	}
+	if strings.ToUpper(cmd.Name()) == "SCAN" {
+		if sent, err := h.scopedScanCmd(ctx, cmd, prefix); err != nil || sent != nil {
+			return sent, err
+		}
+	}
+	if args := cmd.Args(); strings.ToUpper(cmd.Name()) == "KEYS" && len(args) > 1 {
+		if err := h.checkPattern("KEYS", args[1], prefix); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := cmd.(*redis.ScanCmd); ok {
+		// SSCAN, HSCAN and ZSCAN are sent as a prefixed copy too, the ScanIterator sends the cmd again for the next page
+		sent := redis.NewScanCmd(ctx, nil, append([]interface{}(nil), cmd.Args()...)...)
+		if err := h.addPrefixToArgs(ctx, sent, prefix, send); err != nil {
+			return nil, err
+		}
+		return sent, nil
+	}
+	if h.NamespaceFunctions {
+		if done, err := namespaceFunctions(cmd.Args(), prefix); err != nil || done {
+			return cmd, err
+		}
+	}
+	if err := h.addPrefixToArgs(ctx, cmd, prefix, send); err != nil {
+		return nil, err
+	}
+	return cmd, nil
+}
+
+// finishCmd copy the reply of the sent command back to the cmd and strip the prefix from it
+func (h AppPrefixHook) finishCmd(cmd, sent redis.Cmder, prefix string) {
+	if sent != cmd {
+		switch c := cmd.(type) {
+		case *redis.ScanCmd:
+			c.SetVal(sent.(*redis.ScanCmd).Val())
+		case *redis.Cmd:
+			c.SetVal(sent.(*redis.Cmd).Val())
+		}
+		cmd.SetErr(sent.Err())
+	}
+	if skipped(cmd) {
 		return
 	}
+	trimPrefixFromReply(cmd, prefix)
+	if h.NamespaceFunctions {
+		trimFunctionReply(cmd, prefix)
+	}
+}
 
-	name := strings.ToUpper(cmd.Name())
-	switch name {
-	case "MGET", "DEL", "EXISTS", "TOUCH", "UNLINK", "RENAME", "RENAMENX", "PFMERGE", "SINTERSTORE",
-		"SUNIONSTORE", "SDIFFSTORE", "SDIFF", "SINTER", "SUNION", "PFCOUNT":
-		// common multi `key` command
-		for i := 1; i < len(args); i++ {
-			args[i] = h.Prefix + cast.ToString(args[i])
-		}
-	case "MSET": // MSET key1 value1 key2 value2 ...
-		for i := 1; i < len(args); i += 2 {
-			args[i] = h.Prefix + cast.ToString(args[i])
-		}
-	case "BITOP": // BITOP operation destkey key1 key2 ...
-		for i := 2; i < len(args); i++ {
-			args[i] = h.Prefix + cast.ToString(args[i])
-		}
-	case "BRPOP", "BLPOP", "BRPOPLPUSH", "BZPOPMIN", "BZPOPMAX": // BRPOP key [key ...] timeout
-		for i := 1; i < len(args)-1; i++ {
-			args[i] = h.Prefix + cast.ToString(args[i])
-		}
-	case "XINFO", "XGROUP":
-		if len(args) > 2 {
-			args[2] = h.Prefix + cast.ToString(args[2])
-		}
-	case "RPOPLPUSH", "LMOVE", "BLMOVE", "SMOVE", "GEOSEARCHSTORE":
-		if len(args) > 2 {
-			args[1] = h.Prefix + cast.ToString(args[1])
-			args[2] = h.Prefix + cast.ToString(args[2])
-		}
-	case "SCAN":
-		if len(args) > 2 {
-			for i := 2; i < len(args); i += 2 {
-				if strings.ToUpper(cast.ToString(args[i])) == "MATCH" && i+1 < len(args) {
-					args[i+1] = h.Prefix + cast.ToString(args[i+1])
-					break
-				}
-			}
+// scopedScanCmd build a copy of the SCAN command whose MATCH pattern is limited to the prefix, a SCAN without MATCH gets `MATCH prefix*`.
+// the cmd keeps its own args, so the ScanIterator can send it again for the next page without prefixing twice
+func (h AppPrefixHook) scopedScanCmd(ctx context.Context, cmd redis.Cmder, prefix string) (redis.Cmder, error) {
+	// SCAN cursor [MATCH pattern] [COUNT count] [TYPE type]
+	args := cmd.Args()
+	if len(args) < 2 {
+		return nil, nil
+	}
+	scoped := make([]interface{}, 0, len(args)+2)
+	scoped = append(scoped, args[:2]...)
+	matched := false
+	for i := 2; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			scoped = append(scoped, args[i])
+			break
 		}
-	case "SSCAN", "ZSCAN":
-		if len(args) > 3 {
-			args[1] = h.Prefix + cast.ToString(args[1])
-			for i := 3; i < len(args); i += 2 {
-				if strings.ToUpper(cast.ToString(args[i])) == "MATCH" && i+1 < len(args) {
-					args[i+1] = h.Prefix + cast.ToString(args[i+1])
-					break
-				}
+		if !matched && strings.ToUpper(cast.ToString(args[i])) == "MATCH" {
+			if err := h.checkPattern("SCAN", args[i+1], prefix); err != nil {
+				return nil, err
 			}
-		}
-	case "SORT":
-		// SORT command may have `key` and `BY` clause
-		if len(args) > 1 {
-			args[1] = h.Prefix + cast.ToString(args[1])
-			for i := 2; i < len(args); i++ {
-				argsI := strings.ToUpper(cast.ToString(args[i]))
-				if argsI == "BY" || argsI == "GET" {
-					if i+1 < len(args) {
-						args[i+1] = h.Prefix + cast.ToString(args[i+1])
-					}
-				}
+			pattern, err := prefixArg(h.keyPrefix(escapeGlob(prefix), args[i+1]), args[i+1])
+			if err != nil {
+				return nil, err
 			}
+			scoped = append(scoped, args[i], pattern)
+			matched = true
+			continue
 		}
-	case "ZDIFF", "ZINTER", "ZUNION":
-		// ZUNION `key` parameter starts from the second parameter
-		if len(args) > 2 {
-			numKeys := cast.ToInt64(args[1])
-			if numKeys > 0 {
-				for i := 2; i < 2+int(numKeys); i++ {
-					args[i] = h.Prefix + cast.ToString(args[i])
-				}
-			}
+		scoped = append(scoped, args[i], args[i+1])
+	}
+	if !matched {
+		if err := h.checkPattern("SCAN", nil, prefix); err != nil {
+			return nil, err
 		}
-	case "ZUNIONSTORE", "ZINTERSTORE":
-		if len(args) > 1 {
-			args[1] = h.Prefix + cast.ToString(args[1])
+		scoped = append(scoped[:2], append([]interface{}{"match", escapeGlob(prefix) + "*"}, scoped[2:]...)...)
+	}
+
+	switch cmd.(type) {
+	case *redis.ScanCmd:
+		return redis.NewScanCmd(ctx, nil, scoped...), nil
+	case *redis.Cmd:
+		return redis.NewCmd(ctx, scoped...), nil
+	}
+	return nil, nil
+}
+
+// escapeGlob escape the glob metacharacters in s, so it matches itself literally at the head of a KEYS or SCAN MATCH pattern
+func escapeGlob(s string) string {
+	if !strings.ContainsAny(s, `*?[]\`) {
+		return s
+	}
+	var b strings.Builder
+	for _, c := range s {
+		switch c {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
 		}
-		if len(args) > 3 {
-			numKeys := cast.ToInt64(args[2])
-			if numKeys > 0 {
-				for i := 3; i < 3+int(numKeys); i++ {
-					args[i] = h.Prefix + cast.ToString(args[i])
-				}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// public prefix processing function
+func (h AppPrefixHook) addPrefixToArgs(ctx context.Context, cmd redis.Cmder, prefix string, send sendFunc) error {
+	// directly change the args variable, because the memory address is the same
+	args := cmd.Args()
+	if len(args) == 0 {
+		return nil
+	}
+
+	name := strings.ToUpper(cmd.Name())
+	var prefixes map[int]string
+	var patterns map[int]bool
+	var err error
+	if entry, ok := lookupCommand(args); !ok {
+		prefixes, patterns, err = h.discoveredCommand(ctx, name, args, prefix, send)
+	} else if entry.rewrite != nil {
+		prefixes, patterns, err = entry.rewrite(args, prefix)
+	} else {
+		prefixes, patterns, err = keyPrefixes(args, entry.specs, prefix)
+	}
+	if err == nil {
+		err = h.prefixKeys(name, args, prefixes, patterns, prefix)
+	}
+	return h.rewriteErr(ctx, name, prefix, err)
+}
+
+// rewriteErr log the malformed arity of a command, and return the error which fails it
+func (h AppPrefixHook) rewriteErr(ctx context.Context, name, prefix string, err error) error {
+	var arityErr *ArityError
+	if errors.As(err, &arityErr) {
+		h.log(ctx, slog.LevelWarn, LogReasonMalformedArity, name, prefix, slog.Any("error", err))
+	}
+	return err
+}
+
+// ErrSortPatternPrefix is the error of a SORT or SORT_RO with a BY or GET pattern when the prefix has a *: redis substitutes the first *
+// of the pattern, which would be the one of the prefix
+var ErrSortPatternPrefix = errors.New("redis prefix: SORT BY and GET patterns need a prefix without *")
+
+// rewriteSort SORT key [BY pattern] [LIMIT offset count] [GET pattern [GET pattern ...]] [ASC|DESC] [ALPHA] [STORE destination],
+// SORT_RO is the same without STORE. the patterns name keys, e.g. weight_* or weight_*->field, except BY nosort and GET #
+func rewriteSort(args []interface{}, prefix string) (map[int]string, map[int]bool, error) {
+	if len(args) < 2 {
+		return nil, nil, arityError(args, "missing key")
+	}
+	prefixes := map[int]string{1: prefix}
+	patterns := map[int]bool{}
+	for i := 2; i < len(args); i++ {
+		switch option := strings.ToUpper(cast.ToString(args[i])); option {
+		case "LIMIT":
+			i += 2
+		case "BY", "GET", "STORE":
+			if i+1 >= len(args) {
+				return nil, nil, arityError(args, "missing "+option+" argument")
 			}
-		}
-	case "EVAL", "EVALSHA":
-		// EVAL and EVALSHA `key` parameter starts from the third parameter
-		if len(args) > 3 {
-			numKeys := cast.ToInt64(args[2])
-			if numKeys > 0 {
-				for i := 3; i < 3+int(numKeys); i++ {
-					args[i] = h.Prefix + cast.ToString(args[i])
-				}
+			i++
+			switch arg := cast.ToString(args[i]); {
+			case option == "BY" && strings.EqualFold(arg, "nosort"):
+			case option == "GET" && arg == "#":
+			case option == "STORE":
+				prefixes[i] = prefix
+			case strings.Contains(prefix, "*"):
+				return nil, nil, fmt.Errorf("%w: %s %s %s", ErrSortPatternPrefix, args[0], option, arg)
+			default:
+				prefixes[i] = prefix
+				patterns[i] = true
 			}
 		}
-	case "MIGRATE":
-		if len(args) > 4 {
-			if cast.ToString(args[3]) != "" {
-				args[3] = h.Prefix + cast.ToString(args[3])
-			}
-			keysIndex := -1
-			for i := 4; i < len(args); i++ {
-				if strings.ToUpper(cast.ToString(args[i])) == "KEYS" {
-					keysIndex = i
-					break
-				}
+	}
+	return prefixes, patterns, nil
+}
+
+// rewriteMigrate MIGRATE host port key|"" destination-db timeout [COPY] [REPLACE] [AUTH password] [AUTH2 username password] [KEYS key [key ...]],
+// the key is empty when the keys are given after KEYS
+func rewriteMigrate(args []interface{}, prefix string) (map[int]string, map[int]bool, error) {
+	if len(args) < 6 {
+		return nil, nil, arityError(args, fmt.Sprintf("%d arguments, at least 6 expected", len(args)))
+	}
+	prefixes := map[int]string{}
+	if cast.ToString(args[3]) != "" {
+		prefixes[3] = prefix
+	}
+	for i := 6; i < len(args); i++ {
+		switch option := strings.ToUpper(cast.ToString(args[i])); option {
+		case "AUTH":
+			i++
+		case "AUTH2":
+			i += 2
+		case "KEYS":
+			if i+1 >= len(args) {
+				return nil, nil, arityError(args, "missing KEYS argument")
 			}
-			if keysIndex > 0 {
-				for i := keysIndex; i < len(args); i++ {
-					args[i] = h.Prefix + cast.ToString(args[i])
-				}
+			for i++; i < len(args); i++ {
+				prefixes[i] = prefix
 			}
 		}
+	}
+	return prefixes, nil, nil
+}
+
+// discoveredCommand return the prefixes and the patterns of a command the hook does not know by the key specs of the server, when Discovery is set
+func (h AppPrefixHook) discoveredCommand(ctx context.Context, name string, args []interface{}, prefix string, send sendFunc) (map[int]string, map[int]bool, error) {
+	if h.Discovery == nil {
+		return nil, nil, h.unknownCommand(ctx, name, prefix)
+	}
+	specs, found, err := h.Discovery.keySpecs(ctx, send, args)
+	if err != nil {
+		h.log(ctx, slog.LevelWarn, LogReasonDiscoveryFailed, name, prefix, slog.Any("error", err))
+		return nil, nil, h.unknownCommand(ctx, name, prefix)
+	}
+	if !found {
+		return nil, nil, h.unknownCommand(ctx, name, prefix)
+	}
+	return keyPrefixes(args, specs, prefix)
+}
+
+// unknownCommand apply the UnknownCommandPolicy to the command
+func (h AppPrefixHook) unknownCommand(ctx context.Context, name, prefix string) error {
+	switch h.UnknownCommandPolicy {
+	case UnknownCommandReject:
+		h.log(ctx, slog.LevelWarn, LogReasonUnknownCommand, name, prefix)
+		return &UnknownCommandError{Command: name}
+	case UnknownCommandPassThrough:
+		return nil
 	default:
-		if lo.IndexOf[string](commandsWithPrefix, name) != -1 {
-			args[1] = h.Prefix + cast.ToString(args[1])
-		} else {
-			fmt.Println("unsupport app prefix command: ", name)
-		}
+		h.log(ctx, slog.LevelWarn, LogReasonUnknownCommand, name, prefix)
+		return nil
+	}
+}
+
+func (h AppPrefixHook) logger() *slog.Logger {
+	if h.Logger == nil {
+		return slog.Default()
+	}
+	return h.Logger
+}
+
+// log write a diagnostic event of the hook, every event carry the command name, the namespace and the reason
+func (h AppPrefixHook) log(ctx context.Context, level slog.Level, reason, name, prefix string, attrs ...slog.Attr) {
+	h.logger().LogAttrs(ctx, level, "redis prefix: "+reason, append([]slog.Attr{
+		slog.String("command", name),
+		slog.String("namespace", prefix),
+		slog.String("reason", reason),
+	}, attrs...)...)
+}
+
+// logSkipped log the commands which are sent without prefix because of WithSkipPrefix
+func (h AppPrefixHook) logSkipped(ctx context.Context, cmds ...redis.Cmder) {
+	if !h.logger().Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+	prefix, _ := h.resolvePrefix(ctx)
+	for _, cmd := range cmds {
+		h.log(ctx, slog.LevelDebug, LogReasonSkipped, strings.ToUpper(cmd.Name()), prefix)
 	}
 }
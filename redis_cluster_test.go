@@ -1,7 +1,14 @@
 package prefix
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
 	"testing"
 	"time"
 
@@ -10,6 +17,50 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+// stubHook answer the commands locally instead of sending them to redis, it records the args which would go on the wire
+type stubHook struct {
+	sent  *[][]string
+	reply func(cmd redis.Cmder)
+}
+
+func (h stubHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (h stubHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		h.answer(cmd)
+		return cmd.Err()
+	}
+}
+
+func (h stubHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		for _, cmd := range cmds {
+			h.answer(cmd)
+		}
+		return nil
+	}
+}
+
+func (h stubHook) answer(cmd redis.Cmder) {
+	*h.sent = append(*h.sent, cast.ToStringSlice(cmd.Args()))
+	if h.reply != nil {
+		h.reply(cmd)
+	}
+}
+
+// newStubClient create a client with the prefix hook in front of a stubHook, the returned slice collects the sent args
+func newStubClient(hook redis.Hook, reply func(cmd redis.Cmder)) (*redis.Client, *[][]string) {
+	sent := &[][]string{}
+	cli := redis.NewClient(&redis.Options{Addr: "127.0.0.1:0"})
+	cli.AddHook(hook)
+	cli.AddHook(stubHook{sent: sent, reply: reply})
+	return cli, sent
+}
+
 func TestAppPrefixHook(t *testing.T) {
 	Cli := redis.NewUniversalClient(&redis.UniversalOptions{
 		Addrs:    []string{"127.0.0.1:7001", "127.0.0.1:7002", "127.0.0.1:7003", "127.0.0.1:7004", "127.0.0.1:7005", "127.0.0.1:7006"},
@@ -153,6 +204,81 @@ func TestAppPrefixHook(t *testing.T) {
 			cmd:      Cli.LTrim(ctx, "key", 0, -1),
 			expected: []interface{}{"ltrim", prefix + "key", "0", "-1"},
 		},
+		{
+			name:     "XREAD command",
+			cmd:      Cli.XRead(ctx, &redis.XReadArgs{Streams: []string{"key1", "key2", "0", "0"}, Count: 10, Block: -1}),
+			expected: []interface{}{"xread", "count", 10, "streams", prefix + "key1", prefix + "key2", "0", "0"},
+		},
+		{
+			name:     "XREADGROUP command",
+			cmd:      Cli.XReadGroup(ctx, &redis.XReadGroupArgs{Group: "group", Consumer: "consumer", Streams: []string{"key1", "key2", ">", ">"}, Count: 10, Block: -1, NoAck: true}),
+			expected: []interface{}{"xreadgroup", "group", "group", "consumer", "count", 10, "noack", "streams", prefix + "key1", prefix + "key2", ">", ">"},
+		},
+		{
+			name:     "XACK command",
+			cmd:      Cli.XAck(ctx, "key", "group", "1-0", "2-0"),
+			expected: []interface{}{"xack", prefix + "key", "group", "1-0", "2-0"},
+		},
+		{
+			name:     "XCLAIM command",
+			cmd:      Cli.XClaim(ctx, &redis.XClaimArgs{Stream: "key", Group: "group", Consumer: "consumer", MinIdle: time.Second, Messages: []string{"1-0"}}),
+			expected: []interface{}{"xclaim", prefix + "key", "group", "consumer", 1000, "1-0"},
+		},
+		{
+			name:     "XAUTOCLAIM command",
+			cmd:      Cli.XAutoClaim(ctx, &redis.XAutoClaimArgs{Stream: "key", Group: "group", Consumer: "consumer", MinIdle: time.Second, Start: "0-0"}),
+			expected: []interface{}{"xautoclaim", prefix + "key", "group", "consumer", 1000, "0-0"},
+		},
+		{
+			name:     "XPENDING command",
+			cmd:      Cli.XPending(ctx, "key", "group"),
+			expected: []interface{}{"xpending", prefix + "key", "group"},
+		},
+		{
+			name:     "XSETID command",
+			cmd:      Cli.Do(ctx, "xsetid", "key", "1-0"),
+			expected: []interface{}{"xsetid", prefix + "key", "1-0"},
+		},
+		{
+			name:     "LMPOP command",
+			cmd:      Cli.LMPop(ctx, "left", 2, "key1", "key2"),
+			expected: []interface{}{"lmpop", 2, prefix + "key1", prefix + "key2", "left", "count", 2},
+		},
+		{
+			name:     "BLMPOP command",
+			cmd:      Cli.BLMPop(ctx, time.Second, "left", 2, "key1", "key2"),
+			expected: []interface{}{"blmpop", 1, 2, prefix + "key1", prefix + "key2", "left", "count", 2},
+		},
+		{
+			name:     "ZMPOP command",
+			cmd:      Cli.ZMPop(ctx, "min", 2, "key1", "key2"),
+			expected: []interface{}{"zmpop", 2, prefix + "key1", prefix + "key2", "min", "count", 2},
+		},
+		{
+			name:     "BZMPOP command",
+			cmd:      Cli.BZMPop(ctx, time.Second, "min", 2, "key1", "key2"),
+			expected: []interface{}{"bzmpop", 1, 2, prefix + "key1", prefix + "key2", "min", "count", 2},
+		},
+		{
+			name:     "SINTERCARD command",
+			cmd:      Cli.SInterCard(ctx, 10, "key1", "key2"),
+			expected: []interface{}{"sintercard", 2, prefix + "key1", prefix + "key2", "limit", 10},
+		},
+		{
+			name:     "ZINTERCARD command",
+			cmd:      Cli.ZInterCard(ctx, 10, "key1", "key2"),
+			expected: []interface{}{"zintercard", 2, prefix + "key1", prefix + "key2", "limit", 10},
+		},
+		{
+			name:     "ZDIFFSTORE command",
+			cmd:      Cli.ZDiffStore(ctx, "dest", "key1", "key2"),
+			expected: []interface{}{"zdiffstore", prefix + "dest", 2, prefix + "key1", prefix + "key2"},
+		},
+		{
+			name:     "ZRANGESTORE command",
+			cmd:      Cli.ZRangeStore(ctx, "dest", redis.ZRangeArgs{Key: "key", Start: 0, Stop: -1}),
+			expected: []interface{}{"zrangestore", prefix + "dest", prefix + "key", 0, -1},
+		},
 		{
 			name:     "RPOPLPUSH command",
 			cmd:      Cli.RPopLPush(ctx, "key1", "key2"),
@@ -248,11 +374,6 @@ func TestAppPrefixHook(t *testing.T) {
 			cmd:      Cli.HIncrByFloat(ctx, "key", "value", 1),
 			expected: []interface{}{"hincrbyfloat", prefix + "key", "value", "1"},
 		},
-		{
-			name:     "HSCAN command",
-			cmd:      Cli.HScan(ctx, "key", 0, "field前缀", 10),
-			expected: []interface{}{"hscan", prefix + "key", 0, "match", "field前缀", "count", 10},
-		},
 		//{
 		//	name:     "HSTRLEN command",
 		//	cmd:      ,
@@ -449,18 +570,7 @@ func TestAppPrefixHook(t *testing.T) {
 			cmd:      Cli.DecrBy(ctx, "key", 1.0),
 			expected: []interface{}{"decrby", prefix + "key", 1.0},
 		},
-		//{
-		//	name: "WATCH command",
-		//	cmd:  Cli.Watch(ctx, nil, "key1", "key2"),
-		//},
-		//{
-		//	name: "MULTI command",
-		//	cmd: Cli.,
-		//},
-		//{
-		//	name:     "EXEC command",
-		//	cmd: Cli.exe,
-		//},
+		// WATCH, MULTI and EXEC are tested in TestTransactions
 		{
 			name:     "EXPIRE command",
 			cmd:      Cli.Expire(ctx, "key", 0),
@@ -640,19 +750,9 @@ func TestAppPrefixHook(t *testing.T) {
 			expected: []interface{}{"geosearchstore", prefix + "key2", prefix + "key1", "fromlonlat", "0", "0", "bybox", "0", "0", "km"},
 		},
 		{
-			name:     "SCAN command",
-			cmd:      Cli.Scan(ctx, 0, "no:prefix:key", 100),
-			expected: []interface{}{"scan", "0", "match", prefix + "no:prefix:key", "count", "100"},
-		},
-		{
-			name:     "SSCAN command",
-			cmd:      Cli.SScan(ctx, "key1", 0, "no:prefix:key", 100),
-			expected: []interface{}{"sscan", prefix + "key1", 0, "match", prefix + "no:prefix:key", "count", "100"},
-		},
-		{
-			name:     "ZSCAN command",
-			cmd:      Cli.ZScan(ctx, "key1", 0, "no:prefix:key", 100),
-			expected: []interface{}{"zscan", prefix + "key1", "0", "match", prefix + "no:prefix:key", "count", "100"},
+			name:     "KEYS command",
+			cmd:      Cli.Keys(ctx, "key*"),
+			expected: []interface{}{"keys", prefix + "key*"},
 		},
 		{
 			name: "SORT command",
@@ -666,6 +766,26 @@ func TestAppPrefixHook(t *testing.T) {
 			}),
 			expected: []interface{}{"sort", prefix + "key", "by", prefix + "id", "get", prefix + "name", "get", prefix + "age", "desc"},
 		},
+		{
+			name:     "SORT command with special tokens",
+			cmd:      Cli.Sort(ctx, "key", &redis.Sort{By: "nosort", Get: []string{"#", "name_*"}}),
+			expected: []interface{}{"sort", prefix + "key", "by", "nosort", "get", "#", "get", prefix + "name_*"},
+		},
+		{
+			name:     "SORT command with hash field patterns",
+			cmd:      Cli.Sort(ctx, "key", &redis.Sort{By: "weight_*->field", Offset: 0, Count: 10, Get: []string{"object_*->name"}, Alpha: true}),
+			expected: []interface{}{"sort", prefix + "key", "by", prefix + "weight_*->field", "limit", 0, 10, "get", prefix + "object_*->name", "alpha"},
+		},
+		{
+			name:     "SORT STORE command",
+			cmd:      Cli.SortStore(ctx, "key", "dest", &redis.Sort{Get: []string{"#"}}),
+			expected: []interface{}{"sort", prefix + "key", "get", "#", "store", prefix + "dest"},
+		},
+		{
+			name:     "SORT_RO command",
+			cmd:      Cli.SortRO(ctx, "key", &redis.Sort{By: "weight_*", Get: []string{"#"}}),
+			expected: []interface{}{"sort_ro", prefix + "key", "by", prefix + "weight_*", "get", "#"},
+		},
 		{
 			name:     "ZDIFF command",
 			cmd:      Cli.ZDiff(ctx, "key1", "key2", "key3"),
@@ -717,21 +837,271 @@ func TestAppPrefixHook(t *testing.T) {
 			cmd:      Cli.EvalSha(ctx, "hash", []string{"key1", "key2", "key3"}, 1, 2),
 			expected: []interface{}{"evalsha", "hash", 3, prefix + "key1", prefix + "key2", prefix + "key3", 1, 2},
 		},
-		//{
-		//	name:     "GEORADIUS command",
-		//	cmd:      Cli.GeoRadius(ctx, "key", 100, 100, &redis.GeoRadiusQuery{}),
-		//	expected: []interface{}{"georadius", prefix+"key"},
-		//},
-		//{
-		//	name:     "GEORADIUSBYMEMBER command",
-		//	cmd:      Cli.GeoRadiusByMember(ctx, "key", "hehe", &redis.GeoRadiusQuery{}),
-		//	expected: []interface{}{"georadiusbymember", prefix+"key", "hehe", 1, 2},
-		//},
+		{
+			name:     "EVAL_RO command",
+			cmd:      Cli.EvalRO(ctx, "", []string{"key1", "key2"}, 1),
+			expected: []interface{}{"eval_ro", "", 2, prefix + "key1", prefix + "key2", 1},
+		},
+		{
+			name:     "EVALSHA_RO command",
+			cmd:      Cli.EvalShaRO(ctx, "hash", []string{"key1", "key2"}, 1),
+			expected: []interface{}{"evalsha_ro", "hash", 2, prefix + "key1", prefix + "key2", 1},
+		},
+		{
+			name:     "FCALL command",
+			cmd:      Cli.FCall(ctx, "myfunc", []string{"key1", "key2"}, 1),
+			expected: []interface{}{"fcall", "myfunc", 2, prefix + "key1", prefix + "key2", 1},
+		},
+		{
+			name:     "FCALL_RO command",
+			cmd:      Cli.FCallRO(ctx, "myfunc", []string{"key1", "key2"}, 1),
+			expected: []interface{}{"fcall_ro", "myfunc", 2, prefix + "key1", prefix + "key2", 1},
+		},
+		{
+			name:     "GEORADIUS command",
+			cmd:      Cli.GeoRadius(ctx, "key", 100, 50, &redis.GeoRadiusQuery{Radius: 10}),
+			expected: []interface{}{"georadius_ro", prefix + "key", 100, 50, 10, "km"},
+		},
+		{
+			name:     "GEORADIUS STORE command",
+			cmd:      Cli.GeoRadiusStore(ctx, "key", 100, 50, &redis.GeoRadiusQuery{Radius: 10, Store: "dest"}),
+			expected: []interface{}{"georadius", prefix + "key", 100, 50, 10, "km", "store", prefix + "dest"},
+		},
+		{
+			name:     "GEORADIUSBYMEMBER command",
+			cmd:      Cli.GeoRadiusByMember(ctx, "key", "member", &redis.GeoRadiusQuery{Radius: 10}),
+			expected: []interface{}{"georadiusbymember_ro", prefix + "key", "member", 10, "km"},
+		},
+		{
+			name:     "GEORADIUSBYMEMBER STOREDIST command",
+			cmd:      Cli.GeoRadiusByMemberStore(ctx, "key", "member", &redis.GeoRadiusQuery{Radius: 10, StoreDist: "dest"}),
+			expected: []interface{}{"georadiusbymember", prefix + "key", "member", 10, "km", "storedist", prefix + "dest"},
+		},
+		{
+			name:     "GEOHASH command",
+			cmd:      Cli.GeoHash(ctx, "key", "member"),
+			expected: []interface{}{"geohash", prefix + "key", "member"},
+		},
+		{
+			name:     "PEXPIRE command",
+			cmd:      Cli.PExpire(ctx, "key", time.Second),
+			expected: []interface{}{"pexpire", prefix + "key", 1000},
+		},
+		{
+			name:     "EXPIREAT command",
+			cmd:      Cli.ExpireAt(ctx, "key", time.Unix(1700000000, 0)),
+			expected: []interface{}{"expireat", prefix + "key", 1700000000},
+		},
+		{
+			name:     "PEXPIREAT command",
+			cmd:      Cli.PExpireAt(ctx, "key", time.Unix(1700000000, 0)),
+			expected: []interface{}{"pexpireat", prefix + "key", 1700000000000},
+		},
+		{
+			name:     "PERSIST command",
+			cmd:      Cli.Persist(ctx, "key"),
+			expected: []interface{}{"persist", prefix + "key"},
+		},
+		{
+			name:     "PTTL command",
+			cmd:      Cli.PTTL(ctx, "key"),
+			expected: []interface{}{"pttl", prefix + "key"},
+		},
+		{
+			name:     "EXPIRETIME command",
+			cmd:      Cli.ExpireTime(ctx, "key"),
+			expected: []interface{}{"expiretime", prefix + "key"},
+		},
+		{
+			name:     "PEXPIRETIME command",
+			cmd:      Cli.PExpireTime(ctx, "key"),
+			expected: []interface{}{"pexpiretime", prefix + "key"},
+		},
+		{
+			name:     "GETDEL command",
+			cmd:      Cli.GetDel(ctx, "key"),
+			expected: []interface{}{"getdel", prefix + "key"},
+		},
+		{
+			name:     "GETEX command",
+			cmd:      Cli.GetEx(ctx, "key", time.Second),
+			expected: []interface{}{"getex", prefix + "key", "ex", 1},
+		},
+		{
+			name:     "COPY command",
+			cmd:      Cli.Copy(ctx, "key1", "key2", 0, true),
+			expected: []interface{}{"copy", prefix + "key1", prefix + "key2", "DB", 0, "REPLACE"},
+		},
+		{
+			name:     "MOVE command",
+			cmd:      Cli.Move(ctx, "key", 1),
+			expected: []interface{}{"move", prefix + "key", 1},
+		},
+		{
+			name:     "OBJECT ENCODING command",
+			cmd:      Cli.ObjectEncoding(ctx, "key"),
+			expected: []interface{}{"object", "encoding", prefix + "key"},
+		},
+		{
+			name:     "OBJECT FREQ command",
+			cmd:      Cli.ObjectFreq(ctx, "key"),
+			expected: []interface{}{"object", "freq", prefix + "key"},
+		},
+		{
+			name:     "OBJECT IDLETIME command",
+			cmd:      Cli.ObjectIdleTime(ctx, "key"),
+			expected: []interface{}{"object", "idletime", prefix + "key"},
+		},
+		{
+			name:     "OBJECT REFCOUNT command",
+			cmd:      Cli.ObjectRefCount(ctx, "key"),
+			expected: []interface{}{"object", "refcount", prefix + "key"},
+		},
+		{
+			name:     "MEMORY USAGE command",
+			cmd:      Cli.MemoryUsage(ctx, "key"),
+			expected: []interface{}{"memory", "usage", prefix + "key"},
+		},
+		{
+			name:     "DEBUG OBJECT command",
+			cmd:      Cli.DebugObject(ctx, "key"),
+			expected: []interface{}{"debug", "object", prefix + "key"},
+		},
+		{
+			name:     "LPOS command",
+			cmd:      Cli.LPos(ctx, "key", "value", redis.LPosArgs{}),
+			expected: []interface{}{"lpos", prefix + "key", "value"},
+		},
+		{
+			name:     "LPUSHX command",
+			cmd:      Cli.LPushX(ctx, "key", "value"),
+			expected: []interface{}{"lpushx", prefix + "key", "value"},
+		},
+		{
+			name:     "RPUSHX command",
+			cmd:      Cli.RPushX(ctx, "key", "value"),
+			expected: []interface{}{"rpushx", prefix + "key", "value"},
+		},
+		{
+			name:     "HMGET command",
+			cmd:      Cli.HMGet(ctx, "key", "field1", "field2"),
+			expected: []interface{}{"hmget", prefix + "key", "field1", "field2"},
+		},
+		{
+			name:     "HSETNX command",
+			cmd:      Cli.HSetNX(ctx, "key", "field", "value"),
+			expected: []interface{}{"hsetnx", prefix + "key", "field", "value"},
+		},
+		{
+			name:     "HRANDFIELD command",
+			cmd:      Cli.HRandField(ctx, "key", 2),
+			expected: []interface{}{"hrandfield", prefix + "key", 2},
+		},
+		{
+			name:     "SMISMEMBER command",
+			cmd:      Cli.SMIsMember(ctx, "key", "member1", "member2"),
+			expected: []interface{}{"smismember", prefix + "key", "member1", "member2"},
+		},
+		{
+			name:     "ZMSCORE command",
+			cmd:      Cli.ZMScore(ctx, "key", "member1", "member2"),
+			expected: []interface{}{"zmscore", prefix + "key", "member1", "member2"},
+		},
+		{
+			name:     "ZRANDMEMBER command",
+			cmd:      Cli.ZRandMember(ctx, "key", 2),
+			expected: []interface{}{"zrandmember", prefix + "key", 2},
+		},
+		{
+			name:     "ZCOUNT command",
+			cmd:      Cli.ZCount(ctx, "key", "-inf", "+inf"),
+			expected: []interface{}{"zcount", prefix + "key", "-inf", "+inf"},
+		},
+		{
+			name:     "ZLEXCOUNT command",
+			cmd:      Cli.ZLexCount(ctx, "key", "-", "+"),
+			expected: []interface{}{"zlexcount", prefix + "key", "-", "+"},
+		},
+		{
+			name:     "MSETNX command",
+			cmd:      Cli.MSetNX(ctx, "key1", "value1", "key2", "value2"),
+			expected: []interface{}{"msetnx", prefix + "key1", "value1", prefix + "key2", "value2"},
+		},
+		{
+			name:     "LCS command",
+			cmd:      Cli.LCS(ctx, &redis.LCSQuery{Key1: "key1", Key2: "key2"}),
+			expected: []interface{}{"lcs", prefix + "key1", prefix + "key2"},
+		},
+		{
+			name:     "BITFIELD_RO command",
+			cmd:      Cli.BitFieldRO(ctx, "key", "u8", 0),
+			expected: []interface{}{"BITFIELD_RO", prefix + "key", "GET", "u8", 0},
+		},
+		{
+			name:     "HEXPIRE command",
+			cmd:      Cli.HExpire(ctx, "key", time.Minute, "field1", "field2"),
+			expected: []interface{}{"HEXPIRE", prefix + "key", 60, "FIELDS", 2, "field1", "field2"},
+		},
+		{
+			name:     "HPEXPIRE command",
+			cmd:      Cli.HPExpire(ctx, "key", time.Second, "field1"),
+			expected: []interface{}{"HPEXPIRE", prefix + "key", 1000, "FIELDS", 1, "field1"},
+		},
+		{
+			name:     "HEXPIREAT command",
+			cmd:      Cli.HExpireAt(ctx, "key", time.Unix(1700000000, 0), "field1"),
+			expected: []interface{}{"HEXPIREAT", prefix + "key", 1700000000, "FIELDS", 1, "field1"},
+		},
+		{
+			name:     "HPEXPIREAT command",
+			cmd:      Cli.HPExpireAt(ctx, "key", time.Unix(1700000000, 0), "field1"),
+			expected: []interface{}{"HPEXPIREAT", prefix + "key", 1700000000000, "FIELDS", 1, "field1"},
+		},
+		{
+			name:     "HPERSIST command",
+			cmd:      Cli.HPersist(ctx, "key", "field1"),
+			expected: []interface{}{"HPERSIST", prefix + "key", "FIELDS", 1, "field1"},
+		},
+		{
+			name:     "HTTL command",
+			cmd:      Cli.HTTL(ctx, "key", "field1"),
+			expected: []interface{}{"HTTL", prefix + "key", "FIELDS", 1, "field1"},
+		},
+		{
+			name:     "HPTTL command",
+			cmd:      Cli.HPTTL(ctx, "key", "field1"),
+			expected: []interface{}{"HPTTL", prefix + "key", "FIELDS", 1, "field1"},
+		},
+		{
+			name:     "HEXPIRETIME command",
+			cmd:      Cli.HExpireTime(ctx, "key", "field1"),
+			expected: []interface{}{"HEXPIRETIME", prefix + "key", "FIELDS", 1, "field1"},
+		},
+		{
+			name:     "HPEXPIRETIME command",
+			cmd:      Cli.HPExpireTime(ctx, "key", "field1"),
+			expected: []interface{}{"HPEXPIRETIME", prefix + "key", "FIELDS", 1, "field1"},
+		},
 		{
 			name:     "MIGRATE command",
 			cmd:      Cli.Migrate(ctx, "127.0.0.1", "6379", "key", 0, time.Minute),
 			expected: []interface{}{"migrate", "127.0.0.1", "6379", prefix + "key", "0", "60000"},
 		},
+		{
+			name:     "MIGRATE KEYS command",
+			cmd:      Cli.Do(ctx, "migrate", "127.0.0.1", "6379", "", 0, 5000, "KEYS", "key1", "key2"),
+			expected: []interface{}{"migrate", "127.0.0.1", "6379", "", 0, 5000, "KEYS", prefix + "key1", prefix + "key2"},
+		},
+		{
+			name:     "MIGRATE KEYS command with options",
+			cmd:      Cli.Do(ctx, "migrate", "127.0.0.1", "6379", "", 0, 5000, "COPY", "REPLACE", "AUTH", "keys", "AUTH2", "user", "keys", "KEYS", "key1"),
+			expected: []interface{}{"migrate", "127.0.0.1", "6379", "", 0, 5000, "COPY", "REPLACE", "AUTH", "keys", "AUTH2", "user", "keys", "KEYS", prefix + "key1"},
+		},
+		{
+			name:     "MIGRATE command with options",
+			cmd:      Cli.Do(ctx, "migrate", "127.0.0.1", "6379", "key", 0, 5000, "REPLACE", "AUTH", "password"),
+			expected: []interface{}{"migrate", "127.0.0.1", "6379", prefix + "key", 0, 5000, "REPLACE", "AUTH", "password"},
+		},
 	}
 
 	for _, tt := range tests {
@@ -741,3 +1111,633 @@ func TestAppPrefixHook(t *testing.T) {
 		})
 	}
 }
+
+func TestScanNamespace(t *testing.T) {
+	prefix := "prefix4key:"
+	ctx := context.Background()
+	pages := [][]string{{prefix + "key1"}, {prefix + "key2"}}
+	Cli, sent := newStubClient(AppPrefixHook{Prefix: prefix}, func(cmd redis.Cmder) {
+		if c, ok := cmd.(*redis.ScanCmd); ok {
+			page := pages[0]
+			pages = pages[1:]
+			c.SetVal(page, uint64(len(pages)))
+		}
+	})
+
+	tests := []struct {
+		name     string
+		cmd      func() redis.Cmder
+		expected []interface{}
+	}{
+		{
+			name:     "SCAN command",
+			cmd:      func() redis.Cmder { return Cli.Scan(ctx, 0, "no:prefix:key", 100) },
+			expected: []interface{}{"scan", "0", "match", prefix + "no:prefix:key", "count", "100"},
+		},
+		{
+			name:     "SCAN command without MATCH",
+			cmd:      func() redis.Cmder { return Cli.Scan(ctx, 0, "", 100) },
+			expected: []interface{}{"scan", "0", "match", prefix + "*", "count", "100"},
+		},
+		{
+			name:     "SCAN command without MATCH and COUNT",
+			cmd:      func() redis.Cmder { return Cli.Scan(ctx, 0, "", 0) },
+			expected: []interface{}{"scan", "0", "match", prefix + "*"},
+		},
+		{
+			name:     "SCAN TYPE command",
+			cmd:      func() redis.Cmder { return Cli.ScanType(ctx, 0, "", 100, "string") },
+			expected: []interface{}{"scan", "0", "match", prefix + "*", "count", "100", "type", "string"},
+		},
+		{
+			name:     "SCAN command by Do",
+			cmd:      func() redis.Cmder { return Cli.Do(ctx, "scan", 0, "count", 100) },
+			expected: []interface{}{"scan", "0", "match", prefix + "*", "count", "100"},
+		},
+		{
+			name:     "SSCAN command keeps the member pattern",
+			cmd:      func() redis.Cmder { return Cli.SScan(ctx, "set", 0, "a*", 10) },
+			expected: []interface{}{"sscan", prefix + "set", "0", "match", "a*", "count", "10"},
+		},
+		{
+			name:     "SSCAN command without MATCH",
+			cmd:      func() redis.Cmder { return Cli.Do(ctx, "sscan", "set", 0) },
+			expected: []interface{}{"sscan", prefix + "set", "0"},
+		},
+		{
+			name:     "ZSCAN command keeps the member pattern",
+			cmd:      func() redis.Cmder { return Cli.ZScan(ctx, "zset", 0, "a*", 10) },
+			expected: []interface{}{"zscan", prefix + "zset", "0", "match", "a*", "count", "10"},
+		},
+		{
+			name:     "HSCAN command keeps the field pattern",
+			cmd:      func() redis.Cmder { return Cli.HScan(ctx, "hash", 0, "a*", 10) },
+			expected: []interface{}{"hscan", prefix + "hash", "0", "match", "a*", "count", "10"},
+		},
+		{
+			name:     "HSCAN NOVALUES command",
+			cmd:      func() redis.Cmder { return Cli.HScanNoValues(ctx, "hash", 0, "", 0) },
+			expected: []interface{}{"hscan", prefix + "hash", "0", "novalues"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pages = [][]string{{prefix + "key1"}}
+			*sent = nil
+			tt.cmd()
+			assert.Equal(t, [][]string{cast.ToStringSlice(tt.expected)}, *sent)
+		})
+	}
+
+	t.Run("SCAN iterator", func(t *testing.T) {
+		pages = [][]string{{prefix + "key1"}, {prefix + "key2"}}
+		*sent = nil
+		var keys []string
+		iter := Cli.Scan(ctx, 0, "key*", 0).Iterator()
+		for iter.Next(ctx) {
+			keys = append(keys, iter.Val())
+		}
+		assert.NoError(t, iter.Err())
+		assert.Equal(t, []string{"key1", "key2"}, keys)
+		assert.Equal(t, [][]string{
+			{"scan", "0", "match", prefix + "key*"},
+			{"scan", "1", "match", prefix + "key*"},
+		}, *sent)
+	})
+	t.Run("SSCAN iterator", func(t *testing.T) {
+		pages = [][]string{{"member1"}, {"member2"}}
+		*sent = nil
+		var members []string
+		iter := Cli.SScan(ctx, "set", 0, "member*", 0).Iterator()
+		for iter.Next(ctx) {
+			members = append(members, iter.Val())
+		}
+		assert.NoError(t, iter.Err())
+		assert.Equal(t, []string{"member1", "member2"}, members)
+		assert.Equal(t, [][]string{
+			{"sscan", prefix + "set", "0", "match", "member*"},
+			{"sscan", prefix + "set", "1", "match", "member*"},
+		}, *sent)
+	})
+}
+
+func TestEscapeGlob(t *testing.T) {
+	assert.Equal(t, "prefix4key:", escapeGlob("prefix4key:"))
+	assert.Equal(t, `t\*\?\[1\]\\:`, escapeGlob(`t*?[1]\:`))
+
+	prefix := "app[1]*:"
+	ctx := context.Background()
+	Cli, sent := newStubClient(AppPrefixHook{Prefix: prefix}, nil)
+	Cli.Keys(ctx, "user:*")
+	Cli.Scan(ctx, 0, "user:*", 0)
+	Cli.Scan(ctx, 0, "", 0)
+	assert.Equal(t, [][]string{
+		{"keys", `app\[1\]\*:user:*`},
+		{"scan", "0", "match", `app\[1\]\*:user:*`},
+		{"scan", "0", "match", `app\[1\]\*:*`},
+	}, *sent)
+}
+
+func TestSortPatternPrefix(t *testing.T) {
+	ctx := context.Background()
+	Cli, sent := newStubClient(AppPrefixHook{Prefix: "a*b:"}, nil)
+	assert.ErrorIs(t, Cli.Sort(ctx, "list", &redis.Sort{By: "weight_*"}).Err(), ErrSortPatternPrefix)
+	assert.ErrorIs(t, Cli.SortRO(ctx, "list", &redis.Sort{Get: []string{"#", "object_*"}}).Err(), ErrSortPatternPrefix)
+	assert.ErrorIs(t, Cli.Do(ctx, "sort", "list", "by", "nosort", "get", "object_*").Err(), ErrSortPatternPrefix)
+	assert.Empty(t, *sent)
+
+	Cli.Sort(ctx, "list", &redis.Sort{By: "nosort", Get: []string{"#"}})
+	Cli.SortStore(ctx, "list", "dest", &redis.Sort{})
+	assert.Equal(t, [][]string{
+		{"sort", "a*b:list", "by", "nosort", "get", "#"},
+		{"sort", "a*b:list", "store", "a*b:dest"},
+	}, *sent)
+}
+
+func TestDynamicPrefix(t *testing.T) {
+	type tenantKey struct{}
+	errNoTenant := errors.New("no tenant")
+	ctx := context.Background()
+	Cli, sent := newStubClient(AppPrefixHook{
+		Prefix: "static:",
+		PrefixFunc: func(ctx context.Context) (string, error) {
+			tenant, ok := ctx.Value(tenantKey{}).(string)
+			if !ok {
+				return "", errNoTenant
+			}
+			if tenant == "" {
+				return "", nil
+			}
+			return tenant + ":", nil
+		},
+	}, func(cmd redis.Cmder) {
+		if c, ok := cmd.(*redis.StringSliceCmd); ok {
+			c.SetVal([]string{"tenant1:key1"})
+		}
+	})
+
+	t.Run("PrefixFunc", func(t *testing.T) {
+		*sent = nil
+		Cli.Get(context.WithValue(ctx, tenantKey{}, "tenant1"), "key")
+		Cli.Get(context.WithValue(ctx, tenantKey{}, "tenant2"), "key")
+		assert.Equal(t, [][]string{{"get", "tenant1:key"}, {"get", "tenant2:key"}}, *sent)
+	})
+	t.Run("WithPrefix", func(t *testing.T) {
+		*sent = nil
+		Cli.Get(WithPrefix(ctx, "tenant3:"), "key")
+		assert.Equal(t, [][]string{{"get", "tenant3:key"}}, *sent)
+	})
+	t.Run("reply", func(t *testing.T) {
+		keys := Cli.Keys(context.WithValue(ctx, tenantKey{}, "tenant1"), "*").Val()
+		assert.Equal(t, []string{"key1"}, keys)
+	})
+	t.Run("error", func(t *testing.T) {
+		*sent = nil
+		err := Cli.Get(ctx, "key").Err()
+		assert.ErrorIs(t, err, errNoTenant)
+		assert.Empty(t, *sent)
+	})
+	t.Run("pipeline error", func(t *testing.T) {
+		*sent = nil
+		var get *redis.StringCmd
+		_, err := Cli.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			get = pipe.Get(ctx, "key")
+			return nil
+		})
+		assert.ErrorIs(t, err, errNoTenant)
+		assert.ErrorIs(t, get.Err(), errNoTenant)
+		assert.Empty(t, *sent)
+	})
+	t.Run("empty prefix", func(t *testing.T) {
+		*sent = nil
+		assert.ErrorIs(t, Cli.Get(context.WithValue(ctx, tenantKey{}, ""), "key").Err(), ErrEmptyPrefix)
+		assert.ErrorIs(t, Cli.Keys(WithPrefix(ctx, ""), "*").Err(), ErrEmptyPrefix)
+		_, err := Cli.Pipelined(WithPrefix(ctx, ""), func(pipe redis.Pipeliner) error {
+			pipe.Get(ctx, "key")
+			return nil
+		})
+		assert.ErrorIs(t, err, ErrEmptyPrefix)
+		assert.Empty(t, *sent)
+	})
+	t.Run("AllowEmptyPrefix", func(t *testing.T) {
+		Cli, sent := newStubClient(AppPrefixHook{
+			PrefixFunc:       func(ctx context.Context) (string, error) { return "", nil },
+			AllowEmptyPrefix: true,
+		}, nil)
+		assert.NoError(t, Cli.Get(ctx, "key").Err())
+		assert.Equal(t, [][]string{{"get", "key"}}, *sent)
+	})
+}
+
+func TestUnknownCommandPolicy(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("reject", func(t *testing.T) {
+		Cli, sent := newStubClient(AppPrefixHook{Prefix: "prefix4key:", UnknownCommandPolicy: UnknownCommandReject}, nil)
+		err := Cli.Do(ctx, "mymod.flush").Err()
+		var unknownErr *UnknownCommandError
+		assert.ErrorAs(t, err, &unknownErr)
+		assert.Equal(t, "MYMOD.FLUSH", unknownErr.Command)
+		assert.Empty(t, *sent)
+	})
+	t.Run("reject pipeline", func(t *testing.T) {
+		Cli, sent := newStubClient(AppPrefixHook{Prefix: "prefix4key:", UnknownCommandPolicy: UnknownCommandReject}, nil)
+		var get *redis.StringCmd
+		_, err := Cli.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			get = pipe.Get(ctx, "key")
+			pipe.Do(ctx, "mymod.flush")
+			return nil
+		})
+		var unknownErr *UnknownCommandError
+		assert.ErrorAs(t, err, &unknownErr)
+		assert.ErrorAs(t, get.Err(), &unknownErr)
+		assert.Empty(t, *sent)
+	})
+	t.Run("keyless commands", func(t *testing.T) {
+		Cli, sent := newStubClient(AppPrefixHook{Prefix: "prefix4key:", UnknownCommandPolicy: UnknownCommandReject}, nil)
+		Cli.Ping(ctx)
+		Cli.Info(ctx, "server")
+		Cli.ClientID(ctx)
+		Cli.ConfigGet(ctx, "maxmemory")
+		Cli.Publish(ctx, "channel", "message")
+		Cli.Save(ctx)
+		Cli.FunctionList(ctx, redis.FunctionListQuery{})
+		Cli.Do(ctx, "xinfo", "help")
+		for _, args := range *sent {
+			assert.NotContains(t, strings.Join(args, " "), "prefix4key:")
+		}
+		assert.Len(t, *sent, 8)
+	})
+	t.Run("keyless commands across the namespaces", func(t *testing.T) {
+		Cli, sent := newStubClient(AppPrefixHook{Prefix: "prefix4key:", UnknownCommandPolicy: UnknownCommandReject}, nil)
+		var unknownErr *UnknownCommandError
+		assert.ErrorAs(t, Cli.FlushDB(ctx).Err(), &unknownErr)
+		assert.ErrorAs(t, Cli.FlushAll(ctx).Err(), &unknownErr)
+		assert.ErrorAs(t, Cli.Do(ctx, "flushdb").Err(), &unknownErr)
+		assert.ErrorAs(t, Cli.Do(ctx, "swapdb", 0, 1).Err(), &unknownErr)
+		assert.ErrorAs(t, Cli.ScriptFlush(ctx).Err(), &unknownErr)
+		assert.ErrorAs(t, Cli.RandomKey(ctx).Err(), &unknownErr)
+		assert.ErrorAs(t, Cli.DBSize(ctx).Err(), &unknownErr)
+		assert.Empty(t, *sent)
+	})
+	t.Run("subcommand of a container with keys", func(t *testing.T) {
+		Cli, sent := newStubClient(AppPrefixHook{Prefix: "prefix4key:", UnknownCommandPolicy: UnknownCommandReject}, nil)
+		assert.NoError(t, Cli.ObjectFreq(ctx, "key").Err())
+		var unknownErr *UnknownCommandError
+		assert.ErrorAs(t, Cli.Do(ctx, "xinfo", "nosuchsubcommand", "key").Err(), &unknownErr)
+		assert.ErrorAs(t, Cli.Do(ctx, "object").Err(), &unknownErr)
+		assert.Equal(t, [][]string{{"object", "freq", "prefix4key:key"}}, *sent)
+	})
+	t.Run("pass through", func(t *testing.T) {
+		Cli, sent := newStubClient(AppPrefixHook{Prefix: "prefix4key:", UnknownCommandPolicy: UnknownCommandPassThrough}, nil)
+		assert.NoError(t, Cli.Do(ctx, "mymod.flush").Err())
+		assert.Equal(t, [][]string{{"mymod.flush"}}, *sent)
+	})
+	t.Run("log", func(t *testing.T) {
+		Cli, sent := newStubClient(AppPrefixHook{Prefix: "prefix4key:"}, nil)
+		assert.NoError(t, Cli.Do(ctx, "mymod.flush").Err())
+		assert.Equal(t, [][]string{{"mymod.flush"}}, *sent)
+	})
+}
+
+func TestTransactions(t *testing.T) {
+	prefix := "prefix4key:"
+	ctx := context.Background()
+	Cli, sent := newStubClient(AppPrefixHook{Prefix: prefix, UnknownCommandPolicy: UnknownCommandReject}, nil)
+
+	t.Run("TxPipelined", func(t *testing.T) {
+		*sent = nil
+		_, err := Cli.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, "key1", "value", 0)
+			pipe.Incr(ctx, "key2")
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, [][]string{
+			{"multi"},
+			{"set", prefix + "key1", "value"},
+			{"incr", prefix + "key2"},
+			{"exec"},
+		}, *sent)
+	})
+	t.Run("Watch", func(t *testing.T) {
+		*sent = nil
+		err := Cli.Watch(ctx, func(tx *redis.Tx) error {
+			tx.Get(ctx, "key1")
+			_, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Set(ctx, "key1", "value", 0)
+				return nil
+			})
+			return err
+		}, "key1", "key2", "key3")
+		assert.NoError(t, err)
+		assert.Equal(t, [][]string{
+			{"watch", prefix + "key1", prefix + "key2", prefix + "key3"},
+			{"get", prefix + "key1"},
+			{"multi"},
+			{"set", prefix + "key1", "value"},
+			{"exec"},
+			{"unwatch"},
+		}, *sent)
+	})
+	t.Run("WATCH and UNWATCH commands", func(t *testing.T) {
+		*sent = nil
+		assert.NoError(t, Cli.Do(ctx, "watch", "key1", "key2").Err())
+		assert.NoError(t, Cli.Do(ctx, "unwatch").Err())
+		assert.NoError(t, Cli.Do(ctx, "discard").Err())
+		assert.Equal(t, [][]string{
+			{"watch", prefix + "key1", prefix + "key2"},
+			{"unwatch"},
+			{"discard"},
+		}, *sent)
+	})
+}
+
+func TestSkipPrefix(t *testing.T) {
+	prefix := "prefix4key:"
+	ctx := context.Background()
+	Cli, sent := newStubClient(AppPrefixHook{Prefix: prefix, UnknownCommandPolicy: UnknownCommandReject}, func(cmd redis.Cmder) {
+		if c, ok := cmd.(*redis.StringSliceCmd); ok {
+			c.SetVal([]string{prefix + "key1", "global:key"})
+		}
+	})
+
+	t.Run("Pipelined", func(t *testing.T) {
+		*sent = nil
+		var flags *redis.MapStringStringCmd
+		var keys *redis.StringSliceCmd
+		_, err := Cli.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Get(ctx, "key1")
+			flags = SkipPrefix(pipe.HGetAll(ctx, "feature-flags"))
+			keys = SkipPrefix(pipe.Keys(ctx, "*"))
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, [][]string{
+			{"get", prefix + "key1"},
+			{"hgetall", "feature-flags"},
+			{"keys", "*"},
+		}, *sent)
+		assert.Equal(t, "hgetall", flags.Name())
+		assert.Equal(t, []string{prefix + "key1", "global:key"}, keys.Val(), "the reply of a skipped command is not trimmed")
+	})
+	t.Run("TxPipelined", func(t *testing.T) {
+		*sent = nil
+		_, err := Cli.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Incr(ctx, "counter")
+			SkipPrefix(pipe.Incr(ctx, "global:counter"))
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, [][]string{
+			{"multi"},
+			{"incr", prefix + "counter"},
+			{"incr", "global:counter"},
+			{"exec"},
+		}, *sent)
+	})
+	t.Run("sent again", func(t *testing.T) {
+		*sent = nil
+		cmd := SkipPrefix(SkipPrefix(redis.NewStringCmd(ctx, "get", "global:key")))
+		assert.NoError(t, Cli.Process(ctx, cmd))
+		assert.NoError(t, Cli.Process(ctx, cmd))
+		assert.Equal(t, [][]string{{"get", "global:key"}, {"get", "global:key"}}, *sent)
+	})
+	t.Run("ScanIterator", func(t *testing.T) {
+		Cli, sent := newStubClient(AppPrefixHook{Prefix: prefix}, func(cmd redis.Cmder) {
+			if c, ok := cmd.(*redis.ScanCmd); ok {
+				if cast.ToString(c.Args()[1]) == "0" {
+					c.SetVal([]string{"global:a"}, 5)
+				} else {
+					c.SetVal([]string{"global:b"}, 0)
+				}
+			}
+		})
+		// the cmd of a pipeline only queues the next pages, the iterator needs one bound to the client
+		scan := SkipPrefix(redis.NewScanCmd(ctx, Cli.Process, "scan", 0, "count", 10))
+		assert.NoError(t, Cli.Process(ctx, scan))
+		var keys []string
+		iter := scan.Iterator()
+		for iter.Next(ctx) {
+			keys = append(keys, iter.Val())
+		}
+		assert.NoError(t, iter.Err())
+		assert.Equal(t, []string{"global:a", "global:b"}, keys)
+		assert.Equal(t, [][]string{{"scan", "0", "count", "10"}, {"scan", "5", "count", "10"}}, *sent)
+	})
+}
+
+func TestIdempotentPrefix(t *testing.T) {
+	prefix := "prefix4key:"
+	ctx := context.Background()
+	hook := AppPrefixHook{Prefix: prefix}
+	// the key has the prefix in its name, a reply trimmed twice loses it
+	reply := func(cmd redis.Cmder) {
+		if c, ok := cmd.(*redis.StringSliceCmd); ok {
+			c.SetVal([]string{prefix + prefix + "key1"})
+		}
+	}
+
+	t.Run("registered twice", func(t *testing.T) {
+		sent := &[][]string{}
+		Cli := redis.NewClient(&redis.Options{Addr: "127.0.0.1:0"})
+		Cli.AddHook(hook)
+		Cli.AddHook(hook)
+		Cli.AddHook(stubHook{sent: sent, reply: reply})
+		Cli.MGet(ctx, "key1", "key2")
+		assert.Equal(t, []string{prefix + "key1"}, Cli.Keys(ctx, "key*").Val())
+		_, err := Cli.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Get(ctx, "key1")
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, [][]string{
+			{"mget", prefix + "key1", prefix + "key2"},
+			{"keys", prefix + "key*"},
+			{"get", prefix + "key1"},
+		}, *sent)
+	})
+	t.Run("registered twice on a Conn", func(t *testing.T) {
+		sent := &[][]string{}
+		conn := redis.NewClient(&redis.Options{Addr: "127.0.0.1:0"}).Conn()
+		defer conn.Close()
+		conn.AddHook(hook)
+		conn.AddHook(hook)
+		conn.AddHook(stubHook{sent: sent, reply: reply})
+		assert.NoError(t, conn.Set(ctx, "key1", "value", 0).Err())
+		assert.Equal(t, []string{prefix + "key1"}, conn.Keys(ctx, "*key1").Val())
+		_, err := conn.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Get(ctx, "key1")
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, [][]string{
+			{"set", prefix + "key1", "value"},
+			{"keys", prefix + "*key1"},
+			{"get", prefix + "key1"},
+		}, *sent)
+	})
+	t.Run("cmd sent again", func(t *testing.T) {
+		Cli, sent := newStubClient(hook, reply)
+		keys := redis.NewStringSliceCmd(ctx, "keys", "key*")
+		del := redis.NewIntCmd(ctx, "del", "key1", "key2")
+		for i := 0; i < 2; i++ {
+			assert.NoError(t, Cli.Process(ctx, del))
+			assert.NoError(t, Cli.Process(ctx, keys))
+			assert.Equal(t, []string{prefix + "key1"}, keys.Val())
+		}
+		_, err := Cli.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			return pipe.Process(ctx, del)
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, [][]string{
+			{"del", prefix + "key1", prefix + "key2"},
+			{"keys", prefix + "key*"},
+			{"del", prefix + "key1", prefix + "key2"},
+			{"keys", prefix + "key*"},
+			{"del", prefix + "key1", prefix + "key2"},
+		}, *sent)
+	})
+}
+
+func TestArityError(t *testing.T) {
+	ctx := context.Background()
+	Cli, sent := newStubClient(AppPrefixHook{Prefix: "prefix4key:"}, nil)
+
+	tests := []struct {
+		name    string
+		cmd     func() redis.Cmder
+		command string
+		reason  string
+	}{
+		{
+			name:    "EVAL numkeys larger than the keys",
+			cmd:     func() redis.Cmder { return Cli.Do(ctx, "eval", "return 1", 3, "key1") },
+			command: "EVAL",
+			reason:  "missing key at 4, 4 arguments",
+		},
+		{
+			name:    "ZUNIONSTORE numkeys not a number",
+			cmd:     func() redis.Cmder { return Cli.Do(ctx, "zunionstore", "dest", "two", "key1", "key2") },
+			command: "ZUNIONSTORE",
+			reason:  `numkeys "two" is not a number of keys`,
+		},
+		{
+			name:    "ZINTER numkeys missing",
+			cmd:     func() redis.Cmder { return Cli.Do(ctx, "zinter") },
+			command: "ZINTER",
+			reason:  "missing numkeys at 1",
+		},
+		{
+			name:    "GET without key",
+			cmd:     func() redis.Cmder { return Cli.Do(ctx, "get") },
+			command: "GET",
+			reason:  "missing key at 1, 1 arguments",
+		},
+		{
+			name:    "SORT STORE without destination",
+			cmd:     func() redis.Cmder { return Cli.Do(ctx, "sort", "key", "store") },
+			command: "SORT",
+			reason:  "missing STORE argument",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*sent = nil
+			var arityErr *ArityError
+			assert.ErrorAs(t, tt.cmd().Err(), &arityErr)
+			assert.Equal(t, tt.command, arityErr.Command)
+			assert.Equal(t, tt.reason, arityErr.Reason)
+			assert.Empty(t, *sent)
+		})
+	}
+
+	t.Run("pipeline", func(t *testing.T) {
+		*sent = nil
+		var get *redis.StringCmd
+		_, err := Cli.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			get = pipe.Get(ctx, "key")
+			pipe.Do(ctx, "eval", "return 1", 3, "key1")
+			return nil
+		})
+		var arityErr *ArityError
+		assert.ErrorAs(t, err, &arityErr)
+		assert.ErrorAs(t, get.Err(), &arityErr)
+		assert.Empty(t, *sent)
+	})
+}
+
+// FuzzAddPrefixToArgs prove the rewriting never panics, whatever the args of a command
+func FuzzAddPrefixToArgs(f *testing.F) {
+	for _, seed := range []string{
+		"eval return 3 key1", "evalsha sha -1", "zunionstore dest 9223372036854775807 key1", "zinter 2", "zdiff",
+		"sort key by", "sort key limit 0", "sort_ro key get", "migrate host port", "migrate host port  0 0 keys",
+		"xread count 1 streams key", "xreadgroup group g c streams", "object", "memory usage", "xinfo stream",
+		"lmpop 3 key left", "blmpop 0 -1", "georadius key 0 0 1 km store", "scan", "scan 0 match", "sscan",
+		"fcall", "function load", "function list libraryname", "keys", "mset key", "",
+	} {
+		f.Add(seed)
+	}
+	hook := AppPrefixHook{
+		Prefix:               "prefix4key:",
+		UnknownCommandPolicy: UnknownCommandPassThrough,
+		Logger:               slog.New(slog.NewTextHandler(io.Discard, nil)),
+		NamespaceFunctions:   true,
+	}
+	send := func(ctx context.Context, cmds ...redis.Cmder) error { return nil }
+	f.Fuzz(func(t *testing.T, line string) {
+		var args []interface{}
+		for _, arg := range strings.Split(line, " ") {
+			args = append(args, arg)
+		}
+		ctx := context.Background()
+		for _, cmd := range []redis.Cmder{redis.NewCmd(ctx, args...), redis.NewScanCmd(ctx, nil, args...)} {
+			_, _ = hook.prepareCmd(ctx, cmd, hook.Prefix, send)
+		}
+	})
+}
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	ctx := context.Background()
+	Cli, _ := newStubClient(AppPrefixHook{Prefix: "prefix4key:", Logger: logger}, nil)
+
+	events := func() []map[string]interface{} {
+		var events []map[string]interface{}
+		dec := json.NewDecoder(&buf)
+		for dec.More() {
+			var event map[string]interface{}
+			assert.NoError(t, dec.Decode(&event))
+			events = append(events, event)
+		}
+		return events
+	}
+
+	t.Run("unknown command", func(t *testing.T) {
+		Cli.Do(ctx, "mymod.flush")
+		event := events()[0]
+		assert.Equal(t, "WARN", event["level"])
+		assert.Equal(t, "MYMOD.FLUSH", event["command"])
+		assert.Equal(t, "prefix4key:", event["namespace"])
+		assert.Equal(t, LogReasonUnknownCommand, event["reason"])
+	})
+	t.Run("skipped via context", func(t *testing.T) {
+		Cli.Get(WithSkipPrefix(ctx), "key")
+		event := events()[0]
+		assert.Equal(t, "DEBUG", event["level"])
+		assert.Equal(t, "GET", event["command"])
+		assert.Equal(t, LogReasonSkipped, event["reason"])
+	})
+	t.Run("malformed arity", func(t *testing.T) {
+		Cli.Do(ctx, "eval", "return 1", 3, "key1")
+		event := events()[0]
+		assert.Equal(t, "EVAL", event["command"])
+		assert.Equal(t, LogReasonMalformedArity, event["reason"])
+	})
+	t.Run("no events", func(t *testing.T) {
+		Cli.Get(ctx, "key")
+		assert.Empty(t, events())
+	})
+}
@@ -0,0 +1,116 @@
+package prefix
+
+import (
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// trimPrefixFromReply strip the prefix from the key names returned by the command, so the caller gets back the same keys it wrote
+func trimPrefixFromReply(cmd redis.Cmder, prefix string) {
+	if cmd.Err() != nil {
+		return
+	}
+
+	switch strings.ToUpper(cmd.Name()) {
+	case "KEYS": // KEYS pattern -> [key ...]
+		switch c := cmd.(type) {
+		case *redis.StringSliceCmd:
+			c.SetVal(trimKeys(c.Val(), prefix))
+		case *redis.Cmd:
+			trimKeyValues(c.Val(), prefix)
+		}
+	case "SCAN": // SCAN cursor ... -> cursor, [key ...]
+		switch c := cmd.(type) {
+		case *redis.ScanCmd:
+			page, cursor := c.Val()
+			c.SetVal(trimKeys(page, prefix), cursor)
+		case *redis.Cmd:
+			if val, ok := c.Val().([]interface{}); ok && len(val) == 2 {
+				trimKeyValues(val[1], prefix)
+			}
+		}
+	case "RANDOMKEY": // RANDOMKEY is not scoped, a key of another namespace is replied as redis.Nil
+		switch c := cmd.(type) {
+		case *redis.StringCmd:
+			if key, ok := ownKey(c.Val(), prefix); ok {
+				c.SetVal(key)
+			} else {
+				c.SetVal("")
+				c.SetErr(redis.Nil)
+			}
+		case *redis.Cmd:
+			if key, ok := c.Val().(string); ok {
+				if key, ok = ownKey(key, prefix); ok {
+					c.SetVal(key)
+				} else {
+					c.SetVal(nil)
+					c.SetErr(redis.Nil)
+				}
+			}
+		}
+	case "BLPOP", "BRPOP": // BLPOP key [key ...] timeout -> [key, element]
+		if c, ok := cmd.(*redis.StringSliceCmd); ok {
+			if val := c.Val(); len(val) > 0 {
+				val[0] = trimKey(val[0], prefix)
+			}
+		}
+	case "BZPOPMIN", "BZPOPMAX": // BZPOPMIN key [key ...] timeout -> [key, member, score]
+		if c, ok := cmd.(*redis.ZWithKeyCmd); ok {
+			if val := c.Val(); val != nil {
+				val.Key = trimKey(val.Key, prefix)
+			}
+		}
+	case "LMPOP", "BLMPOP": // LMPOP numkeys key [key ...] LEFT|RIGHT -> [key, [element ...]]
+		if c, ok := cmd.(*redis.KeyValuesCmd); ok {
+			key, val := c.Val()
+			c.SetVal(trimKey(key, prefix), val)
+		}
+	case "ZMPOP", "BZMPOP": // ZMPOP numkeys key [key ...] MIN|MAX -> [key, [member score ...]]
+		if c, ok := cmd.(*redis.ZSliceWithKeyCmd); ok {
+			key, val := c.Val()
+			c.SetVal(trimKey(key, prefix), val)
+		}
+	case "XREAD", "XREADGROUP": // XREAD ... STREAMS key [key ...] id [id ...] -> [[key, [entry ...]] ...]
+		if c, ok := cmd.(*redis.XStreamSliceCmd); ok {
+			streams := c.Val()
+			for i := range streams {
+				streams[i].Stream = trimKey(streams[i].Stream, prefix)
+			}
+		}
+	}
+}
+
+// trimKey strip the prefix from the key, or the prefix without its braces from a key which keeps its own hash tag, see KeepKeyHashTag
+func trimKey(key, prefix string) string {
+	if strings.HasPrefix(key, prefix) {
+		return key[len(prefix):]
+	}
+	if untagged := untaggedPrefix(prefix); untagged != prefix && strings.HasPrefix(key, untagged) && hashTag([]byte(key[len(untagged):])) != nil {
+		return key[len(untagged):]
+	}
+	return key
+}
+
+// ownKey strip the prefix from the key, false when the key is not in the namespace of the prefix
+func ownKey(key, prefix string) (string, bool) {
+	trimmed := trimKey(key, prefix)
+	return trimmed, prefix == "" || trimmed != key
+}
+
+func trimKeys(keys []string, prefix string) []string {
+	for i := range keys {
+		keys[i] = trimKey(keys[i], prefix)
+	}
+	return keys
+}
+
+// trimKeyValues strip the prefix from the key names of a generic reply, e.g. of Cli.Do(ctx, "keys", "*"), it is an array of strings
+func trimKeyValues(val interface{}, prefix string) {
+	keys, _ := val.([]interface{})
+	for i, key := range keys {
+		if key, ok := key.(string); ok {
+			keys[i] = trimKey(key, prefix)
+		}
+	}
+}
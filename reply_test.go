@@ -0,0 +1,140 @@
+package prefix
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrimPrefixFromReply(t *testing.T) {
+	prefix := "prefix4key:"
+	ctx := context.Background()
+	Cli, _ := newStubClient(AppPrefixHook{Prefix: prefix}, func(cmd redis.Cmder) {
+		switch c := cmd.(type) {
+		case *redis.StringSliceCmd:
+			c.SetVal([]string{prefix + "key1", prefix + "key2"})
+		case *redis.ScanCmd:
+			c.SetVal([]string{prefix + "key1", prefix + "key2"}, 7)
+		case *redis.StringCmd:
+			c.SetVal(prefix + "key1")
+		case *redis.ZWithKeyCmd:
+			c.SetVal(&redis.ZWithKey{Z: redis.Z{Score: 1, Member: prefix + "member"}, Key: prefix + "key1"})
+		case *redis.KeyValuesCmd:
+			c.SetVal(prefix+"key1", []string{prefix + "value"})
+		case *redis.ZSliceWithKeyCmd:
+			c.SetVal(prefix+"key1", []redis.Z{{Score: 1, Member: prefix + "member"}})
+		case *redis.XStreamSliceCmd:
+			c.SetVal([]redis.XStream{{Stream: prefix + "key1"}, {Stream: prefix + "key2"}})
+		case *redis.Cmd:
+			keys := []interface{}{prefix + "key1", prefix + "key2"}
+			switch c.Name() {
+			case "keys":
+				c.SetVal(keys)
+			case "scan":
+				c.SetVal([]interface{}{"7", keys})
+			case "randomkey":
+				c.SetVal(prefix + "key1")
+			}
+		}
+	})
+
+	t.Run("KEYS command", func(t *testing.T) {
+		assert.Equal(t, []string{"key1", "key2"}, Cli.Keys(ctx, "key*").Val())
+	})
+	t.Run("SCAN command", func(t *testing.T) {
+		keys, cursor := Cli.Scan(ctx, 0, "key*", 10).Val()
+		assert.Equal(t, []string{"key1", "key2"}, keys)
+		assert.Equal(t, uint64(7), cursor)
+	})
+	t.Run("SSCAN command keeps members", func(t *testing.T) {
+		members, _ := Cli.SScan(ctx, "key", 0, "", 10).Val()
+		assert.Equal(t, []string{prefix + "key1", prefix + "key2"}, members)
+	})
+	t.Run("RANDOMKEY command", func(t *testing.T) {
+		assert.Equal(t, "key1", Cli.RandomKey(ctx).Val())
+	})
+	t.Run("RANDOMKEY of another namespace", func(t *testing.T) {
+		Cli, _ := newStubClient(AppPrefixHook{Prefix: prefix}, func(cmd redis.Cmder) {
+			switch c := cmd.(type) {
+			case *redis.StringCmd:
+				c.SetVal("other:secret")
+			case *redis.Cmd:
+				c.SetVal("other:secret")
+			}
+		})
+		key, err := Cli.RandomKey(ctx).Result()
+		assert.ErrorIs(t, err, redis.Nil)
+		assert.Empty(t, key)
+		val, err := Cli.Do(ctx, "randomkey").Result()
+		assert.ErrorIs(t, err, redis.Nil)
+		assert.Nil(t, val)
+		var randomKey *redis.StringCmd
+		_, err = Cli.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			randomKey = pipe.RandomKey(ctx)
+			return nil
+		})
+		assert.ErrorIs(t, err, redis.Nil)
+		assert.ErrorIs(t, randomKey.Err(), redis.Nil)
+	})
+	t.Run("GET command keeps value", func(t *testing.T) {
+		assert.Equal(t, prefix+"key1", Cli.Get(ctx, "key").Val())
+	})
+	t.Run("BLPOP command", func(t *testing.T) {
+		assert.Equal(t, []string{"key1", prefix + "key2"}, Cli.BLPop(ctx, time.Second, "key1").Val())
+	})
+	t.Run("BRPOP command", func(t *testing.T) {
+		assert.Equal(t, []string{"key1", prefix + "key2"}, Cli.BRPop(ctx, time.Second, "key1").Val())
+	})
+	t.Run("BZPOPMIN command", func(t *testing.T) {
+		val := Cli.BZPopMin(ctx, time.Second, "key1").Val()
+		assert.Equal(t, "key1", val.Key)
+		assert.Equal(t, prefix+"member", val.Member)
+	})
+	t.Run("LMPOP command", func(t *testing.T) {
+		key, values := Cli.LMPop(ctx, "left", 1, "key1").Val()
+		assert.Equal(t, "key1", key)
+		assert.Equal(t, []string{prefix + "value"}, values)
+	})
+	t.Run("ZMPOP command", func(t *testing.T) {
+		key, _ := Cli.ZMPop(ctx, "min", 1, "key1").Val()
+		assert.Equal(t, "key1", key)
+	})
+	t.Run("BLMPOP command", func(t *testing.T) {
+		key, _ := Cli.BLMPop(ctx, time.Second, "left", 1, "key1", "key2").Val()
+		assert.Equal(t, "key1", key)
+	})
+	t.Run("BZMPOP command", func(t *testing.T) {
+		key, _ := Cli.BZMPop(ctx, time.Second, "min", 1, "key1", "key2").Val()
+		assert.Equal(t, "key1", key)
+	})
+	t.Run("XREAD command", func(t *testing.T) {
+		streams := Cli.XRead(ctx, &redis.XReadArgs{Streams: []string{"key1", "key2", "0", "0"}}).Val()
+		assert.Equal(t, "key1", streams[0].Stream)
+		assert.Equal(t, "key2", streams[1].Stream)
+	})
+	t.Run("XREADGROUP command", func(t *testing.T) {
+		streams := Cli.XReadGroup(ctx, &redis.XReadGroupArgs{Group: "group", Consumer: "consumer", Streams: []string{"key1", "key2", ">", ">"}}).Val()
+		assert.Equal(t, "key1", streams[0].Stream)
+		assert.Equal(t, "key2", streams[1].Stream)
+	})
+	t.Run("Do", func(t *testing.T) {
+		assert.Equal(t, []interface{}{"key1", "key2"}, Cli.Do(ctx, "keys", "key*").Val())
+		assert.Equal(t, []interface{}{"7", []interface{}{"key1", "key2"}}, Cli.Do(ctx, "scan", 0).Val())
+		assert.Equal(t, "key1", Cli.Do(ctx, "randomkey").Val())
+	})
+	t.Run("pipeline", func(t *testing.T) {
+		var keys *redis.StringSliceCmd
+		_, err := Cli.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			keys = pipe.Keys(ctx, "key*")
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"key1", "key2"}, keys.Val())
+	})
+	t.Run("skip prefix", func(t *testing.T) {
+		assert.Equal(t, []string{prefix + "key1", prefix + "key2"}, Cli.Keys(WithSkipPrefix(ctx), "key*").Val())
+	})
+}
@@ -0,0 +1,286 @@
+package prefix
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// slotCount the number of hash slots of a redis cluster
+const slotCount = 16384
+
+// crc16Table the CRC16 XMODEM table redis cluster hashes the keys with
+var crc16Table = func() (table [256]uint16) {
+	for i := range table {
+		crc := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}()
+
+func crc16(b []byte) uint16 {
+	var crc uint16
+	for _, c := range b {
+		crc = crc<<8 ^ crc16Table[byte(crc>>8)^c]
+	}
+	return crc
+}
+
+// keySlot return the cluster slot of the key, only its hash tag is hashed when it has one
+func keySlot(key []byte) int {
+	if tag := hashTag(key); tag != nil {
+		key = tag
+	}
+	return int(crc16(key)) % slotCount
+}
+
+// hashTag return the hash tag of the key: what is between the first { and the first } after it, nil when it is missing or empty
+func hashTag(key []byte) []byte {
+	start := bytes.IndexByte(key, '{')
+	if start < 0 {
+		return nil
+	}
+	end := bytes.IndexByte(key[start+1:], '}')
+	if end <= 0 {
+		return nil
+	}
+	return key[start+1 : start+1+end]
+}
+
+// hashTagPrefix make the prefix a hash tag, so the whole namespace lives in one slot: "tenant42:" -> "{tenant42}:", "app" -> "{app}".
+// the trailing separators stay out of the tag, a prefix which already has a hash tag is unchanged
+func hashTagPrefix(prefix string) string {
+	if prefix == "" || hashTag([]byte(prefix)) != nil {
+		return prefix
+	}
+	name := strings.TrimRightFunc(prefix, func(c rune) bool {
+		return !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9')
+	})
+	if name == "" {
+		return prefix
+	}
+	return "{" + name + "}" + prefix[len(name):]
+}
+
+// untaggedPrefix the prefix without its braces, a key which has its own hash tag gets it with KeepKeyHashTag: "{tenant42}:" -> "tenant42:"
+func untaggedPrefix(prefix string) string {
+	return strings.NewReplacer("{", "", "}", "").Replace(prefix)
+}
+
+// keyPrefix return the prefix of the key arg, the untagged prefix when KeepKeyHashTag keeps the hash tag of the key
+func (h AppPrefixHook) keyPrefix(prefix string, arg interface{}) string {
+	if !h.KeepKeyHashTag || hashTag([]byte(prefix)) == nil {
+		return prefix
+	}
+	key, err := appendArg(nil, arg)
+	if err != nil || hashTag(key) == nil {
+		return prefix
+	}
+	return untaggedPrefix(prefix)
+}
+
+// ErrUntaggedPattern is the error of a KEYS or SCAN whose pattern can match keys of both prefix forms of KeepKeyHashTag,
+// only a pattern which starts with a hash tag, e.g. "{user1}:*", lists all the keys it matches
+var ErrUntaggedPattern = errors.New("redis prefix: with KeepKeyHashTag, KEYS and SCAN need a pattern which starts with a hash tag")
+
+// checkPattern fail a KEYS or SCAN pattern which would hide keys with KeepKeyHashTag: the keys with a hash tag are stored under
+// the prefix without braces, the others under the prefix, and one pattern only matches one of them. a nil pattern is a SCAN without MATCH
+func (h AppPrefixHook) checkPattern(name string, pattern interface{}, prefix string) error {
+	if !h.KeepKeyHashTag || hashTag([]byte(prefix)) == nil {
+		return nil
+	}
+	if pattern == nil {
+		return fmt.Errorf("%w: %s without MATCH", ErrUntaggedPattern, name)
+	}
+	b, err := appendArg(nil, pattern)
+	if err != nil || taggedPattern(b) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s %s", ErrUntaggedPattern, name, b)
+}
+
+// taggedPattern report whether all the keys the pattern matches have its hash tag: the pattern has no glob metacharacter up to
+// the end of its hash tag, e.g. "{user1}:*" but not "*{user1}" or "{user*}"
+func taggedPattern(pattern []byte) bool {
+	tag := hashTag(pattern)
+	if tag == nil {
+		return false
+	}
+	end := bytes.IndexByte(pattern, '{') + len(tag) + 2
+	return !bytes.ContainsAny(pattern[:end], `*?[]\`)
+}
+
+// prefixKeys add the prefixes to the `key` args at their positions, after checking the prefixed keys still share their slots.
+// the keys matching ExemptKeys get an empty prefix, they are left as is but still count for the slots. the patterns, e.g. of KEYS
+// or SORT BY, are never exempt: a pattern which matches an exempt glob can still match the keys of the namespace
+func (h AppPrefixHook) prefixKeys(name string, args []interface{}, prefixes map[int]string, patterns map[int]bool, prefix string) error {
+	for i, p := range prefixes {
+		switch {
+		case !patterns[i] && h.exemptKey(args[i]):
+			prefixes[i] = ""
+		case p == prefix || p == escapeGlob(prefix):
+			prefixes[i] = h.keyPrefix(p, args[i])
+		}
+	}
+	if err := h.checkSlots(name, args, prefixes, prefix); err != nil {
+		return err
+	}
+	return prefixArgs(args, prefixes)
+}
+
+// checkSlots fail a multi-key command whose prefixed keys hash to different slots: with CheckCrossSlot, and in the hash tag modes,
+// i.e. when the prefix has a hash tag or KeepKeyHashTag is set, when the keys shared a slot before they were prefixed
+func (h AppPrefixHook) checkSlots(name string, args []interface{}, prefixes map[int]string, prefix string) error {
+	if len(prefixes) < 2 || !h.CheckCrossSlot && !h.KeepKeyHashTag && hashTag([]byte(prefix)) == nil {
+		return nil
+	}
+	if h.SplitCrossSlot && splitCommands[name] {
+		return nil
+	}
+	positions := make([]int, 0, len(prefixes))
+	for i := range prefixes {
+		positions = append(positions, i)
+	}
+	sort.Ints(positions)
+
+	keys := make([]string, 0, len(positions))
+	slots := make([]int, 0, len(positions))
+	colocated, split := true, false
+	first := -1
+	for _, i := range positions {
+		key, err := appendArg(nil, args[i])
+		if err != nil {
+			// prefixArgs fails the command
+			return nil
+		}
+		if first < 0 {
+			first = keySlot(key)
+		}
+		colocated = colocated && keySlot(key) == first
+		prefixed := append([]byte(prefixes[i]), key...)
+		keys = append(keys, string(prefixed))
+		slots = append(slots, keySlot(prefixed))
+		split = split || slots[len(slots)-1] != slots[0]
+	}
+	if split && (colocated || h.CheckCrossSlot) {
+		return &CrossSlotError{Command: name, Keys: keys, Slots: slots, Colocated: colocated}
+	}
+	return nil
+}
+
+// splitCommands the commands SplitCrossSlot sends as one command per slot, all their args after the name are keys
+var splitCommands = map[string]bool{"DEL": true, "UNLINK": true, "EXISTS": true, "TOUCH": true, "MGET": true}
+
+// splitCmd return the commands the cmd is sent as: one per slot of its keys with SplitCrossSlot, or the cmd itself
+func (h AppPrefixHook) splitCmd(ctx context.Context, cmd redis.Cmder) []redis.Cmder {
+	args := cmd.Args()
+	if !h.SplitCrossSlot || len(args) < 3 || !splitCommands[strings.ToUpper(cmd.Name())] {
+		return []redis.Cmder{cmd}
+	}
+	var slots []int
+	keys := map[int][]interface{}{}
+	for _, arg := range args[1:] {
+		key, err := appendArg(nil, arg)
+		if err != nil {
+			return []redis.Cmder{cmd}
+		}
+		slot := keySlot(key)
+		if _, ok := keys[slot]; !ok {
+			slots = append(slots, slot)
+		}
+		keys[slot] = append(keys[slot], arg)
+	}
+	if len(slots) == 1 {
+		return []redis.Cmder{cmd}
+	}
+
+	parts := make([]redis.Cmder, 0, len(slots))
+	for _, slot := range slots {
+		partArgs := append([]interface{}{args[0]}, keys[slot]...)
+		switch cmd.(type) {
+		case *redis.IntCmd:
+			parts = append(parts, redis.NewIntCmd(ctx, partArgs...))
+		case *redis.SliceCmd:
+			parts = append(parts, redis.NewSliceCmd(ctx, partArgs...))
+		case *redis.Cmd:
+			parts = append(parts, redis.NewCmd(ctx, partArgs...))
+		default:
+			return []redis.Cmder{cmd}
+		}
+	}
+	return parts
+}
+
+// mergeCmd set the reply of the cmd split by splitCmd from the replies of its parts: the sum of the counts,
+// or the MGET values in the order of the keys. the cmd fails with the first error of its parts
+func mergeCmd(cmd redis.Cmder, parts []redis.Cmder) {
+	if len(parts) == 1 && parts[0] == cmd {
+		return
+	}
+	for _, part := range parts {
+		if err := part.Err(); err != nil {
+			cmd.SetErr(err)
+			return
+		}
+	}
+
+	if !strings.EqualFold(cmd.Name(), "MGET") {
+		var count int64
+		for _, part := range parts {
+			switch c := part.(type) {
+			case *redis.IntCmd:
+				count += c.Val()
+			case *redis.Cmd:
+				n, _ := c.Int64()
+				count += n
+			}
+		}
+		switch c := cmd.(type) {
+		case *redis.IntCmd:
+			c.SetVal(count)
+		case *redis.Cmd:
+			c.SetVal(count)
+		}
+		return
+	}
+
+	// the values of each slot, in the order of its keys
+	slotValues := map[int][]interface{}{}
+	for _, part := range parts {
+		key, _ := appendArg(nil, part.Args()[1])
+		switch c := part.(type) {
+		case *redis.SliceCmd:
+			slotValues[keySlot(key)] = c.Val()
+		case *redis.Cmd:
+			slotValues[keySlot(key)], _ = c.Slice()
+		}
+	}
+	values := make([]interface{}, 0, len(cmd.Args())-1)
+	for _, arg := range cmd.Args()[1:] {
+		key, _ := appendArg(nil, arg)
+		slot := keySlot(key)
+		var value interface{}
+		if len(slotValues[slot]) > 0 {
+			value, slotValues[slot] = slotValues[slot][0], slotValues[slot][1:]
+		}
+		values = append(values, value)
+	}
+	switch c := cmd.(type) {
+	case *redis.SliceCmd:
+		c.SetVal(values)
+	case *redis.Cmd:
+		c.SetVal(values)
+	}
+}
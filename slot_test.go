@@ -0,0 +1,321 @@
+package prefix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeySlot(t *testing.T) {
+	tests := []struct {
+		key  string
+		slot int
+	}{
+		{"123456789", 12739},
+		{"foo", 12182},
+		{"bar", 5061},
+		{"{bar}foo", 5061},
+		{"foo{bar}{zap}", 5061},
+		{"foo{}{bar}", keySlot([]byte("foo{}{bar}"))},
+		{"{user1000}.following", keySlot([]byte("user1000"))},
+		{"{user1000}.followers", keySlot([]byte("user1000"))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			assert.Equal(t, tt.slot, keySlot([]byte(tt.key)))
+		})
+	}
+	assert.NotEqual(t, keySlot([]byte("foo{}{bar}")), keySlot([]byte("bar")), "an empty hash tag hashes the whole key")
+}
+
+func TestHashTag(t *testing.T) {
+	tests := []struct {
+		key string
+		tag string
+	}{
+		{"{user1}:cart", "user1"},
+		{"cart:{user1}", "user1"},
+		{"foo{{bar}}zap", "{bar"},
+		{"foo{bar}{zap}", "bar"},
+		{"foo{}{bar}", ""},
+		{"foo{bar", ""},
+		{"foo", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			assert.Equal(t, tt.tag, string(hashTag([]byte(tt.key))))
+		})
+	}
+}
+
+func TestHashTagPrefix(t *testing.T) {
+	tests := []struct {
+		prefix   string
+		expected string
+	}{
+		{"tenant42:", "{tenant42}:"},
+		{"tenant:1:", "{tenant:1}:"},
+		{"app", "{app}"},
+		{"{tenant42}:", "{tenant42}:"},
+		{"app:{shard1}:", "app:{shard1}:"},
+		{":", ":"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			assert.Equal(t, tt.expected, hashTagPrefix(tt.prefix))
+		})
+	}
+}
+
+func TestHashTagModes(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("HashTagPrefix", func(t *testing.T) {
+		Cli, sent := newStubClient(AppPrefixHook{Prefix: "tenant42:", HashTagPrefix: true}, func(cmd redis.Cmder) {
+			if c, ok := cmd.(*redis.StringSliceCmd); ok {
+				c.SetVal([]string{"{tenant42}:a"})
+			}
+		})
+		Cli.MGet(ctx, "a", "b")
+		Cli.Get(WithPrefix(ctx, "tenant7:"), "a")
+		Cli.Get(ctx, "{user1}:cart")
+		assert.Equal(t, [][]string{
+			{"mget", "{tenant42}:a", "{tenant42}:b"},
+			{"get", "{tenant7}:a"},
+			{"get", "{tenant42}:{user1}:cart"},
+		}, *sent)
+		assert.Equal(t, []string{"a"}, Cli.Keys(ctx, "*").Val())
+	})
+
+	t.Run("KeepKeyHashTag", func(t *testing.T) {
+		Cli, sent := newStubClient(AppPrefixHook{Prefix: "tenant42:", HashTagPrefix: true, KeepKeyHashTag: true}, func(cmd redis.Cmder) {
+			if c, ok := cmd.(*redis.StringSliceCmd); ok {
+				c.SetVal([]string{"tenant42:{user1}:cart", "0"})
+			}
+		})
+		Cli.MSet(ctx, "{user1}:cart", 1, "{user1}:orders", 2)
+		Cli.Get(ctx, "plain")
+		Cli.Scan(ctx, 0, "{user1}:*", 10)
+		assert.Equal(t, [][]string{
+			{"mset", "tenant42:{user1}:cart", "1", "tenant42:{user1}:orders", "2"},
+			{"get", "{tenant42}:plain"},
+			{"scan", "0", "match", "tenant42:{user1}:*", "count", "10"},
+		}, *sent)
+		assert.Equal(t, []string{"{user1}:cart", "0"}, Cli.BLPop(ctx, 0, "{user1}:cart").Val())
+	})
+
+	t.Run("KeepKeyHashTag patterns", func(t *testing.T) {
+		Cli, sent := newStubClient(AppPrefixHook{Prefix: "{tenant42}:", KeepKeyHashTag: true}, nil)
+		// a pattern without a leading hash tag can match keys of both prefix forms, one of them would be hidden
+		for _, cmd := range []redis.Cmder{
+			Cli.Keys(ctx, "*"),
+			Cli.Keys(ctx, "plain*"),
+			Cli.Keys(ctx, "*{user1}"),
+			Cli.Keys(ctx, "{user*}:cart"),
+			Cli.Scan(ctx, 0, "", 10),
+			Cli.Scan(ctx, 0, "*", 10),
+			Cli.ScanType(ctx, 0, "", 10, "hash"),
+			Cli.Do(ctx, "scan", 0),
+		} {
+			assert.ErrorIs(t, cmd.Err(), ErrUntaggedPattern, cmd.String())
+		}
+		assert.EqualError(t, Cli.Scan(ctx, 0, "", 10).Err(), ErrUntaggedPattern.Error()+": SCAN without MATCH")
+		assert.Empty(t, *sent)
+
+		Cli.Keys(ctx, "{user1}:*")
+		Cli.Scan(ctx, 0, "{user1}:*", 10)
+		assert.Equal(t, [][]string{
+			{"keys", "tenant42:{user1}:*"},
+			{"scan", "0", "match", "tenant42:{user1}:*", "count", "10"},
+		}, *sent)
+
+		// without KeepKeyHashTag all the keys have the same prefix
+		Cli, sent = newStubClient(AppPrefixHook{Prefix: "{tenant42}:"}, nil)
+		assert.NoError(t, Cli.Keys(ctx, "*").Err())
+		assert.Equal(t, [][]string{{"keys", "{tenant42}:*"}}, *sent)
+	})
+
+	t.Run("KeepKeyHashTag without hash tag in the prefix", func(t *testing.T) {
+		Cli, sent := newStubClient(AppPrefixHook{Prefix: "app:", KeepKeyHashTag: true}, nil)
+		Cli.Get(ctx, "{user1}:cart")
+		assert.Equal(t, [][]string{{"get", "app:{user1}:cart"}}, *sent)
+	})
+
+	t.Run("broken co-location", func(t *testing.T) {
+		// "{user1}:cart" and "user1" share a slot, but only the first one keeps its hash tag
+		Cli, sent := newStubClient(AppPrefixHook{Prefix: "{tenant42}:", KeepKeyHashTag: true}, nil)
+		err := Cli.MGet(ctx, "{user1}:cart", "user1").Err()
+		var crossSlot *CrossSlotError
+		if assert.True(t, errors.As(err, &crossSlot)) {
+			assert.Equal(t, "MGET", crossSlot.Command)
+			assert.Equal(t, []string{"tenant42:{user1}:cart", "{tenant42}:user1"}, crossSlot.Keys)
+			assert.Equal(t, []int{keySlot([]byte("user1")), keySlot([]byte("tenant42"))}, crossSlot.Slots)
+			assert.True(t, crossSlot.Colocated)
+		}
+		assert.Contains(t, err.Error(), "tenant42:{user1}:cart (slot")
+		assert.Empty(t, *sent)
+	})
+
+	t.Run("keys in different slots", func(t *testing.T) {
+		// the keys did not share a slot before they were prefixed, the prefix does not break anything
+		Cli, sent := newStubClient(AppPrefixHook{Prefix: "{tenant42}:", KeepKeyHashTag: true}, nil)
+		assert.NoError(t, Cli.MGet(ctx, "{user1}:cart", "{user2}:cart").Err())
+		assert.Equal(t, [][]string{{"mget", "tenant42:{user1}:cart", "tenant42:{user2}:cart"}}, *sent)
+	})
+}
+
+func TestCheckCrossSlot(t *testing.T) {
+	ctx := context.Background()
+	Cli, sent := newStubClient(AppPrefixHook{Prefix: "app:", CheckCrossSlot: true}, nil)
+
+	t.Run("cross slot", func(t *testing.T) {
+		*sent = nil
+		for _, cmd := range []redis.Cmder{
+			Cli.MGet(ctx, "a", "b"),
+			Cli.Rename(ctx, "a", "b"),
+			Cli.SInterStore(ctx, "dest", "a", "b"),
+			Cli.Eval(ctx, "return 1", []string{"a", "b"}),
+		} {
+			var crossSlot *CrossSlotError
+			if assert.True(t, errors.As(cmd.Err(), &crossSlot), cmd.Name()) {
+				assert.False(t, crossSlot.Colocated)
+				assert.Contains(t, crossSlot.Keys, "app:b")
+			}
+		}
+		err := Cli.MGet(ctx, "a", "b").Err()
+		assert.EqualError(t, err, fmt.Sprintf("redis prefix: the keys of MGET hash to different slots: app:a (slot %d), app:b (slot %d)",
+			keySlot([]byte("app:a")), keySlot([]byte("app:b"))))
+		assert.Empty(t, *sent)
+	})
+	t.Run("same slot", func(t *testing.T) {
+		*sent = nil
+		assert.NoError(t, Cli.MGet(ctx, "{user1}:a", "{user1}:b").Err())
+		assert.NoError(t, Cli.Get(ctx, "a").Err())
+		assert.Len(t, *sent, 2)
+	})
+	t.Run("pipeline", func(t *testing.T) {
+		*sent = nil
+		var get *redis.StringCmd
+		_, err := Cli.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			get = pipe.Get(ctx, "a")
+			pipe.Del(ctx, "a", "b")
+			return nil
+		})
+		var crossSlot *CrossSlotError
+		assert.True(t, errors.As(err, &crossSlot))
+		assert.Error(t, get.Err())
+		assert.Empty(t, *sent)
+	})
+}
+
+func TestSplitCrossSlot(t *testing.T) {
+	ctx := context.Background()
+	// "app:{t}a" and "app:{t}c" share the slot of "t", "app:b" has another one
+	assert.NotEqual(t, keySlot([]byte("t")), keySlot([]byte("app:b")))
+	var failSlot int
+	Cli, sent := newStubClient(AppPrefixHook{Prefix: "app:", CheckCrossSlot: true, SplitCrossSlot: true}, func(cmd redis.Cmder) {
+		key, _ := appendArg(nil, cmd.Args()[len(cmd.Args())-1])
+		if keySlot(key) == failSlot {
+			cmd.SetErr(errors.New("MOVED"))
+			return
+		}
+		keys := make([]interface{}, 0, len(cmd.Args())-1)
+		for _, arg := range cmd.Args()[1:] {
+			keys = append(keys, fmt.Sprint(arg))
+		}
+		switch c := cmd.(type) {
+		case *redis.IntCmd:
+			c.SetVal(int64(len(keys)))
+		case *redis.SliceCmd:
+			c.SetVal(keys)
+		case *redis.Cmd:
+			if strings.EqualFold(cmd.Name(), "MGET") {
+				c.SetVal(keys)
+			} else {
+				c.SetVal(int64(len(keys)))
+			}
+		}
+	})
+
+	t.Run("DEL", func(t *testing.T) {
+		*sent = nil
+		assert.Equal(t, int64(3), Cli.Del(ctx, "{t}a", "b", "{t}c").Val())
+		assert.Equal(t, [][]string{{"del", "app:{t}a", "app:{t}c"}, {"del", "app:b"}}, *sent)
+	})
+	t.Run("EXISTS by Do", func(t *testing.T) {
+		*sent = nil
+		n, err := Cli.Do(ctx, "exists", "{t}a", "b").Int64()
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), n)
+		assert.Len(t, *sent, 2)
+	})
+	t.Run("MGET", func(t *testing.T) {
+		*sent = nil
+		values, err := Cli.MGet(ctx, "{t}a", "b", "{t}c").Result()
+		assert.NoError(t, err)
+		assert.Equal(t, []interface{}{"app:{t}a", "app:b", "app:{t}c"}, values)
+		assert.Equal(t, [][]string{{"mget", "app:{t}a", "app:{t}c"}, {"mget", "app:b"}}, *sent)
+		values, err = Cli.Do(ctx, "mget", "b", "{t}a").Slice()
+		assert.NoError(t, err)
+		assert.Equal(t, []interface{}{"app:b", "app:{t}a"}, values)
+	})
+	t.Run("same slot", func(t *testing.T) {
+		*sent = nil
+		Cli.Del(ctx, "{t}a", "{t}c")
+		assert.Equal(t, [][]string{{"del", "app:{t}a", "app:{t}c"}}, *sent)
+	})
+	t.Run("pipeline", func(t *testing.T) {
+		*sent = nil
+		var del *redis.IntCmd
+		var get *redis.StringCmd
+		_, err := Cli.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			del = pipe.Unlink(ctx, "{t}a", "b")
+			get = pipe.Get(ctx, "b")
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), del.Val())
+		assert.Equal(t, "get app:b: ", get.String())
+		assert.Equal(t, [][]string{{"unlink", "app:{t}a"}, {"unlink", "app:b"}, {"get", "app:b"}}, *sent)
+	})
+	t.Run("TxPipelined", func(t *testing.T) {
+		for _, hook := range []AppPrefixHook{{Prefix: "app:", SplitCrossSlot: true}, {Prefix: "app:", CheckCrossSlot: true, SplitCrossSlot: true}} {
+			Cli, sent := newStubClient(hook, nil)
+			var del *redis.IntCmd
+			_, err := Cli.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				del = pipe.Del(ctx, "{t}a", "b")
+				return nil
+			})
+			var crossSlot *CrossSlotError
+			assert.True(t, errors.As(err, &crossSlot))
+			assert.True(t, errors.As(del.Err(), &crossSlot))
+			assert.Empty(t, *sent)
+
+			_, err = Cli.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Del(ctx, "{t}a", "{t}c")
+				return nil
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, [][]string{{"multi"}, {"del", "app:{t}a", "app:{t}c"}, {"exec"}}, *sent)
+		}
+		// the hook still splits outside of a transaction
+		Cli, sent := newStubClient(AppPrefixHook{Prefix: "app:", SplitCrossSlot: true}, nil)
+		Cli.Del(ctx, "{t}a", "b")
+		assert.Len(t, *sent, 2)
+	})
+	t.Run("other multi-key commands", func(t *testing.T) {
+		var crossSlot *CrossSlotError
+		assert.True(t, errors.As(Cli.Rename(ctx, "{t}a", "b").Err(), &crossSlot))
+	})
+	t.Run("part error", func(t *testing.T) {
+		failSlot = keySlot([]byte("app:b"))
+		defer func() { failSlot = 0 }()
+		assert.EqualError(t, Cli.Del(ctx, "{t}a", "b").Err(), "MOVED")
+	})
+}